@@ -0,0 +1,163 @@
+package entry
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// AccessLogOption customizes the access logging performed by Middleware
+type AccessLogOption func(*accessLogConfig)
+
+// AccessLogRule controls how often successful requests to matching paths are logged,
+// e.g. to keep health checks and polling endpoints from flooding the logs. Requests
+// that result in an error status (400 or above) are always logged, regardless of any
+// rules.
+type AccessLogRule struct {
+	// PathPrefix selects the requests to which this rule applies: either an exact path
+	// (e.g. '/healthz') or, if it ends in a slash, any path beneath it
+	PathPrefix string
+
+	// SampleRate is the fraction of successful requests that are logged, between 0 (no
+	// requests are logged) and 1 (all requests are logged)
+	SampleRate float64
+}
+
+// WithAccessLogRules configures sampling/suppression rules for access logs: for each
+// request, the first rule whose PathPrefix matches the request path is applied, and
+// requests that match no rule are always logged
+func WithAccessLogRules(rules ...AccessLogRule) AccessLogOption {
+	return func(c *accessLogConfig) {
+		c.rules = append(c.rules, rules...)
+	}
+}
+
+// WithRedactedPathSegments causes any segment of a request path that fully matches one
+// of the given patterns to be replaced with ':redacted' in logs, e.g. so that tokens
+// embedded in URLs aren't written to the logs verbatim
+func WithRedactedPathSegments(patterns ...*regexp.Regexp) AccessLogOption {
+	return func(c *accessLogConfig) {
+		c.redactedSegments = append(c.redactedSegments, patterns...)
+	}
+}
+
+// WithLoggedQueryParams causes the values of any query parameters whose names fully
+// match one of the given patterns to be logged verbatim. By default, query parameter
+// names are logged but their values are replaced with ':redacted', since query strings
+// often carry credentials (e.g. the signature of a signed URL).
+func WithLoggedQueryParams(patterns ...*regexp.Regexp) AccessLogOption {
+	return func(c *accessLogConfig) {
+		c.loggedParams = append(c.loggedParams, patterns...)
+	}
+}
+
+// WithLoggedHeaders causes the values of the given request headers (e.g. User-Agent
+// and Referer) to be included in each request's log messages, when present
+func WithLoggedHeaders(names ...string) AccessLogOption {
+	return func(c *accessLogConfig) {
+		c.headers = append(c.headers, names...)
+	}
+}
+
+// WithAccessLog configures the access logging performed for an HTTP server
+func WithAccessLog(opts ...AccessLogOption) ServerOption {
+	return func(c *serverConfig) {
+		c.accessLog = append(c.accessLog, opts...)
+	}
+}
+
+// accessLogConfig accumulates the settings specified via AccessLogOption values
+type accessLogConfig struct {
+	rules            []AccessLogRule
+	redactedSegments []*regexp.Regexp
+	loggedParams     []*regexp.Regexp
+	headers          []string
+	random           func() float64
+}
+
+func newAccessLogConfig(opts []AccessLogOption) *accessLogConfig {
+	c := &accessLogConfig{
+		random: rand.Float64,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// sampleRate returns the fraction of successful requests to the given path that
+// should be logged
+func (c *accessLogConfig) sampleRate(path string) float64 {
+	for _, rule := range c.rules {
+		if path == rule.PathPrefix || (strings.HasSuffix(rule.PathPrefix, "/") && strings.HasPrefix(path, rule.PathPrefix)) {
+			return rule.SampleRate
+		}
+	}
+	return 1
+}
+
+// shouldLog decides whether a finished request should be logged, given its status and
+// the sample rate resolved for its path
+func (c *accessLogConfig) shouldLog(status int, sampleRate float64) bool {
+	if status < 100 || status >= 400 || sampleRate >= 1 {
+		return true
+	}
+	if sampleRate <= 0 {
+		return false
+	}
+	return c.random() < sampleRate
+}
+
+// redactPath returns the given path with any sensitive segments redacted
+func (c *accessLogConfig) redactPath(path string) string {
+	if len(c.redactedSegments) == 0 {
+		return path
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if segment != "" && matchesAny(c.redactedSegments, segment) {
+			segments[i] = ":redacted"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// redactQuery returns the given query string with the values of all parameters that
+// haven't been explicitly allowed via WithLoggedQueryParams redacted
+func (c *accessLogConfig) redactQuery(query url.Values) string {
+	redacted := make(url.Values, len(query))
+	for name, values := range query {
+		if !matchesAny(c.loggedParams, name) {
+			values = []string{":redacted"}
+		}
+		redacted[name] = values
+	}
+	return redacted.Encode()
+}
+
+// requestAttrs returns the attributes that should be added to the logger for the given
+// request, with sensitive values redacted
+func (c *accessLogConfig) requestAttrs(r *http.Request) []any {
+	attrs := []any{"path", c.redactPath(r.URL.Path)}
+	if r.URL.RawQuery != "" {
+		attrs = append(attrs, "query", c.redactQuery(r.URL.Query()))
+	}
+	for _, name := range c.headers {
+		if value := r.Header.Get(name); value != "" {
+			attrs = append(attrs, "header."+strings.ToLower(name), value)
+		}
+	}
+	return attrs
+}
+
+// matchesAny returns true if s fully matches any of the given patterns
+func matchesAny(patterns []*regexp.Regexp, s string) bool {
+	for _, pattern := range patterns {
+		if loc := pattern.FindStringIndex(s); loc != nil && loc[0] == 0 && loc[1] == len(s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package entry
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Middleware_accessLog(t *testing.T) {
+	handler := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if strings.HasSuffix(req.URL.Path, "/fail") {
+			res.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		res.WriteHeader(http.StatusOK)
+	})
+
+	doRequest := func(opts []AccessLogOption, target string, headers map[string]string) string {
+		var buf bytes.Buffer
+		logger := slog.New(slog.NewJSONHandler(&buf, nil))
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		Middleware(logger, opts...)(handler).ServeHTTP(httptest.NewRecorder(), req)
+		return buf.String()
+	}
+
+	t.Run("requests are logged by default", func(t *testing.T) {
+		out := doRequest(nil, "/healthz", nil)
+		assert.Contains(t, out, `"msg":"Request finished"`)
+		assert.Contains(t, out, `"path":"/healthz"`)
+	})
+	t.Run("rules can suppress successful requests, but not errors", func(t *testing.T) {
+		opts := []AccessLogOption{WithAccessLogRules(
+			AccessLogRule{PathPrefix: "/healthz", SampleRate: 0},
+			AccessLogRule{PathPrefix: "/static/", SampleRate: 0},
+		)}
+		assert.Empty(t, doRequest(opts, "/healthz", nil))
+		assert.Empty(t, doRequest(opts, "/static/app.js", nil))
+		assert.Contains(t, doRequest(opts, "/static/fail", nil), `"status":500`)
+		assert.Contains(t, doRequest(opts, "/healthz/more", nil), `"msg":"Request finished"`)
+	})
+	t.Run("rules can sample successful requests", func(t *testing.T) {
+		config := newAccessLogConfig([]AccessLogOption{WithAccessLogRules(AccessLogRule{PathPrefix: "/poll", SampleRate: 0.25})})
+		config.random = func() float64 { return 0.2 }
+		assert.True(t, config.shouldLog(http.StatusOK, config.sampleRate("/poll")))
+		config.random = func() float64 { return 0.3 }
+		assert.False(t, config.shouldLog(http.StatusOK, config.sampleRate("/poll")))
+		assert.True(t, config.shouldLog(http.StatusNotFound, config.sampleRate("/poll")))
+		assert.True(t, config.shouldLog(http.StatusOK, config.sampleRate("/other")))
+	})
+	t.Run("sensitive path segments are redacted", func(t *testing.T) {
+		opts := []AccessLogOption{WithRedactedPathSegments(regexp.MustCompile(`tok_[a-z0-9]+`))}
+		out := doRequest(opts, "/invites/tok_abc123/accept", nil)
+		assert.Contains(t, out, `"path":"/invites/:redacted/accept"`)
+		assert.NotContains(t, out, "abc123")
+	})
+	t.Run("query param values are redacted by default", func(t *testing.T) {
+		out := doRequest(nil, "/media?signature=hunter2&page=2", nil)
+		assert.Contains(t, out, `"query":"page=%3Aredacted&signature=%3Aredacted"`)
+		assert.NotContains(t, out, "hunter2")
+	})
+	t.Run("allowed query params are logged verbatim", func(t *testing.T) {
+		opts := []AccessLogOption{WithLoggedQueryParams(regexp.MustCompile(`page|limit`))}
+		out := doRequest(opts, "/media?signature=hunter2&page=2", nil)
+		assert.Contains(t, out, `"query":"page=2&signature=%3Aredacted"`)
+		assert.NotContains(t, out, "hunter2")
+	})
+	t.Run("selected headers are logged", func(t *testing.T) {
+		opts := []AccessLogOption{WithLoggedHeaders("User-Agent", "Referer")}
+		out := doRequest(opts, "/", map[string]string{"user-agent": "curl/8.0"})
+		assert.Contains(t, out, `"header.user-agent":"curl/8.0"`)
+		assert.NotContains(t, out, "header.referer")
+	})
+}
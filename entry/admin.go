@@ -0,0 +1,160 @@
+package entry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// DefaultAdminBindAddr is the address that an admin server binds to if no BindAddr is
+// configured, ensuring that it's only reachable from the local machine
+const DefaultAdminBindAddr = "127.0.0.1"
+
+// RequestVerifier authenticates an HTTP request given its body: it's satisfied by
+// hmac.Verifier
+type RequestVerifier interface {
+	Verify(req *http.Request, body []byte) error
+}
+
+// AdminConfig describes an admin server, which exposes diagnostic endpoints that must
+// not be served on an application's public port:
+//
+//   - /debug/pprof/ serves profiles, CPU profiles and execution traces, as would
+//     net/http/pprof
+//   - /debug/vars serves the command line and memstats, in expvar's format (but not
+//     any variables published via expvar)
+//   - /debug/goroutines serves a full dump of all goroutine stacks
+//   - /debug/runtime serves a JSON summary of runtime stats
+//   - /debug/buildinfo serves the module build info embedded in the binary
+//
+// These handlers are only served by the admin server: unlike net/http/pprof and
+// expvar, this package registers nothing on http.DefaultServeMux.
+type AdminConfig struct {
+	// BindAddr is the address to listen on; if empty, DefaultAdminBindAddr is used
+	BindAddr   string
+	ListenPort uint16
+
+	// Verifier, if set, is used to authenticate every request to the admin server
+	// (e.g. via an hmac.Verifier): unverified requests are rejected with 401
+	Verifier RequestVerifier
+
+	// Handlers registers additional routes on the admin server, e.g. mapping
+	// '/loglevel' to Application.LogLevelHandler()
+	Handlers map[string]http.Handler
+}
+
+// WithAdminServer causes an admin server, as described by config, to be run alongside
+// the main server, whether it's run via RunServer, RunGRPCServer, or RunServers
+func WithAdminServer(config AdminConfig) ServerOption {
+	return func(c *serverConfig) {
+		c.admin = &config
+	}
+}
+
+// NewAdminServer prepares an admin server, as described by config, to be run via
+// RunServers
+func NewAdminServer(config AdminConfig) Server {
+	bindAddr := config.BindAddr
+	if bindAddr == "" {
+		bindAddr = DefaultAdminBindAddr
+	}
+	return &adminServer{
+		httpServer: httpServer{
+			handler:    newAdminHandler(config),
+			bindAddr:   bindAddr,
+			listenPort: config.ListenPort,
+			config: serverConfig{
+				httpTimeouts: &HTTPTimeouts{
+					ReadHeaderTimeout: DefaultHTTPTimeouts.ReadHeaderTimeout,
+					IdleTimeout:       DefaultHTTPTimeouts.IdleTimeout,
+					MaxHeaderBytes:    DefaultHTTPTimeouts.MaxHeaderBytes,
+				},
+			},
+		},
+	}
+}
+
+// adminServer is the Server implementation returned by NewAdminServer: it's an ordinary
+// HTTP server, minus the read and write timeouts that would interfere with long-running
+// profiles and traces, and with log messages identifying it as the admin server
+type adminServer struct {
+	httpServer
+}
+
+func (s *adminServer) Serve(ctx context.Context, logger *slog.Logger) error {
+	return s.httpServer.Serve(ctx, logger.With("server", "admin"))
+}
+
+// newAdminHandler builds the http.Handler that serves all admin routes
+func newAdminHandler(config AdminConfig) http.Handler {
+	startTime := time.Now()
+
+	mux := http.NewServeMux()
+	registerDebugHandlers(mux)
+	mux.HandleFunc("/debug/runtime", func(res http.ResponseWriter, req *http.Request) {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		res.Header().Set("content-type", "application/json")
+		json.NewEncoder(res).Encode(map[string]any{
+			"goVersion":      runtime.Version(),
+			"uptimeSeconds":  time.Since(startTime).Seconds(),
+			"numGoroutine":   runtime.NumGoroutine(),
+			"numCPU":         runtime.NumCPU(),
+			"gomaxprocs":     runtime.GOMAXPROCS(0),
+			"heapAllocBytes": m.HeapAlloc,
+			"heapInuseBytes": m.HeapInuse,
+			"sysBytes":       m.Sys,
+			"numGC":          m.NumGC,
+			"pauseTotalNs":   m.PauseTotalNs,
+		})
+	})
+	mux.HandleFunc("/debug/buildinfo", func(res http.ResponseWriter, req *http.Request) {
+		info, ok := debug.ReadBuildInfo()
+		if !ok {
+			WriteError(res, req, &Error{Status: http.StatusNotFound, Code: "not_found", Message: "build info is not available"})
+			return
+		}
+		res.Header().Set("content-type", "text/plain")
+		fmt.Fprint(res, info.String())
+	})
+	for pattern, handler := range config.Handlers {
+		mux.Handle(pattern, handler)
+	}
+
+	if config.Verifier == nil {
+		return mux
+	}
+	return requireVerified(config.Verifier)(mux)
+}
+
+// requireVerified returns middleware that rejects any request that isn't authenticated
+// by the given verifier
+func requireVerified(v RequestVerifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+			if err == nil {
+				err = v.Verify(r, body)
+			}
+			if err != nil {
+				Log(r).Warn("Rejecting unverified admin request", "error", err)
+				WriteError(w, r, &Error{
+					Status:  http.StatusUnauthorized,
+					Code:    "unauthorized",
+					Message: "request could not be verified",
+					Err:     err,
+				})
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package entry
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The handlers in this file serve the same endpoints as net/http/pprof and expvar, but
+// they're built directly on runtime/pprof and runtime/trace: importing net/http/pprof or
+// expvar would register their handlers on http.DefaultServeMux, exposing them on any
+// public server that serves it.
+
+// defaultCPUProfileDuration and defaultTraceDuration are the durations for which CPU
+// profiles and execution traces are collected when no 'seconds' parameter is given
+const (
+	defaultCPUProfileDuration = 30 * time.Second
+	defaultTraceDuration      = time.Second
+)
+
+// registerDebugHandlers adds the pprof, expvar-style vars, and goroutine dump
+// endpoints to the given mux
+func registerDebugHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", servePprofIndex)
+	mux.HandleFunc("/debug/pprof/cmdline", serveCmdline)
+	mux.HandleFunc("/debug/pprof/profile", serveCPUProfile)
+	mux.HandleFunc("/debug/pprof/symbol", serveSymbol)
+	mux.HandleFunc("/debug/pprof/trace", serveTrace)
+	mux.HandleFunc("/debug/vars", serveVars)
+	mux.HandleFunc("/debug/goroutines", func(res http.ResponseWriter, req *http.Request) {
+		serveProfile(res, req, "goroutine", 2)
+	})
+}
+
+// servePprofIndex serves the named runtime profile given by the request path (e.g.
+// '/debug/pprof/heap'), or an index of all available profiles
+func servePprofIndex(res http.ResponseWriter, req *http.Request) {
+	if name := strings.TrimPrefix(req.URL.Path, "/debug/pprof/"); name != "" {
+		debug, _ := strconv.Atoi(req.FormValue("debug"))
+		serveProfile(res, req, name, debug)
+		return
+	}
+
+	res.Header().Set("content-type", "text/html; charset=utf-8")
+	fmt.Fprint(res, "<html><head><title>/debug/pprof/</title></head><body>\n<p>Profiles:</p>\n<ul>\n")
+	for _, p := range pprof.Profiles() {
+		name := html.EscapeString(p.Name())
+		fmt.Fprintf(res, "<li><a href=\"%s?debug=1\">%s</a> (%d)</li>\n", name, name, p.Count())
+	}
+	fmt.Fprint(res, "<li><a href=\"profile\">profile</a> (CPU profile)</li>\n")
+	fmt.Fprint(res, "<li><a href=\"trace?seconds=1\">trace</a> (execution trace)</li>\n")
+	fmt.Fprint(res, "</ul>\n</body></html>\n")
+}
+
+// serveProfile writes the named runtime profile, in the legacy text format if debug is
+// nonzero or in the gzipped protobuf format otherwise
+func serveProfile(res http.ResponseWriter, req *http.Request, name string, debug int) {
+	p := pprof.Lookup(name)
+	if p == nil {
+		WriteError(res, req, &Error{Status: http.StatusNotFound, Code: "not_found", Message: fmt.Sprintf("unknown profile '%s'", name)})
+		return
+	}
+	if name == "heap" && req.FormValue("gc") != "" {
+		runtime.GC()
+	}
+	res.Header().Set("x-content-type-options", "nosniff")
+	if debug != 0 {
+		res.Header().Set("content-type", "text/plain; charset=utf-8")
+	} else {
+		res.Header().Set("content-type", "application/octet-stream")
+		res.Header().Set("content-disposition", fmt.Sprintf(`attachment; filename="%s"`, name))
+	}
+	p.WriteTo(res, debug)
+}
+
+// serveCmdline writes the process's command line, with arguments separated by NUL bytes
+func serveCmdline(res http.ResponseWriter, req *http.Request) {
+	res.Header().Set("content-type", "text/plain; charset=utf-8")
+	fmt.Fprint(res, strings.Join(os.Args, "\x00"))
+}
+
+// serveCPUProfile collects a CPU profile for the number of seconds given by the
+// 'seconds' parameter, then writes it in the gzipped protobuf format
+func serveCPUProfile(res http.ResponseWriter, req *http.Request) {
+	duration := profileDuration(req, defaultCPUProfileDuration)
+	res.Header().Set("content-type", "application/octet-stream")
+	res.Header().Set("content-disposition", `attachment; filename="profile"`)
+	if err := pprof.StartCPUProfile(res); err != nil {
+		res.Header().Del("content-disposition")
+		WriteError(res, req, &Error{Status: http.StatusInternalServerError, Code: "profiling_failed", Message: "could not enable CPU profiling", Err: err})
+		return
+	}
+	sleepForProfile(req, duration)
+	pprof.StopCPUProfile()
+}
+
+// serveTrace collects an execution trace for the number of seconds given by the
+// 'seconds' parameter, writing it as it's collected
+func serveTrace(res http.ResponseWriter, req *http.Request) {
+	duration := profileDuration(req, defaultTraceDuration)
+	res.Header().Set("content-type", "application/octet-stream")
+	res.Header().Set("content-disposition", `attachment; filename="trace"`)
+	if err := trace.Start(res); err != nil {
+		res.Header().Del("content-disposition")
+		WriteError(res, req, &Error{Status: http.StatusInternalServerError, Code: "tracing_failed", Message: "could not enable tracing", Err: err})
+		return
+	}
+	sleepForProfile(req, duration)
+	trace.Stop()
+}
+
+// serveSymbol resolves program counters to function names, as used by 'go tool pprof':
+// a GET request reports that symbol lookup is supported, and a POST request whose body
+// is a '+'-separated list of hex addresses is answered with one line per address
+func serveSymbol(res http.ResponseWriter, req *http.Request) {
+	res.Header().Set("content-type", "text/plain; charset=utf-8")
+	fmt.Fprint(res, "num_symbols: 1\n")
+	if req.Method != http.MethodPost {
+		return
+	}
+	r := bufio.NewReader(req.Body)
+	for {
+		word, err := r.ReadString('+')
+		word = strings.TrimSuffix(word, "+")
+		if pc, parseErr := strconv.ParseUint(word, 0, 64); parseErr == nil && pc != 0 {
+			if f := runtime.FuncForPC(uintptr(pc)); f != nil {
+				fmt.Fprintf(res, "%#x %s\n", pc, f.Name())
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// serveVars writes the process's command line and memory statistics as JSON, in the
+// format served by expvar
+func serveVars(res http.ResponseWriter, req *http.Request) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	res.Header().Set("content-type", "application/json; charset=utf-8")
+	json.NewEncoder(res).Encode(map[string]any{
+		"cmdline":  os.Args,
+		"memstats": m,
+	})
+}
+
+// profileDuration returns the duration requested via the 'seconds' parameter, or the
+// given default if none was given
+func profileDuration(req *http.Request, defaultDuration time.Duration) time.Duration {
+	if seconds, err := strconv.ParseFloat(req.FormValue("seconds"), 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	return defaultDuration
+}
+
+// sleepForProfile waits for the given duration while a profile is collected, or until
+// the client goes away
+func sleepForProfile(req *http.Request, duration time.Duration) {
+	select {
+	case <-time.After(duration):
+	case <-req.Context().Done():
+	}
+}
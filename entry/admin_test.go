@@ -0,0 +1,111 @@
+package entry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_newAdminHandler(t *testing.T) {
+	t.Run("diagnostic endpoints are served", func(t *testing.T) {
+		h := newAdminHandler(AdminConfig{
+			Handlers: map[string]http.Handler{
+				"/hello": http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+					res.Write([]byte("hello"))
+				}),
+			},
+		})
+		for _, path := range []string{"/debug/pprof/", "/debug/pprof/heap", "/debug/pprof/goroutine?debug=1", "/debug/pprof/cmdline", "/debug/pprof/profile?seconds=0.01", "/debug/pprof/trace?seconds=0.01", "/debug/vars", "/debug/goroutines", "/debug/runtime", "/hello"} {
+			res := httptest.NewRecorder()
+			h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, path, nil))
+			assert.Equal(t, http.StatusOK, res.Code, path)
+		}
+
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/debug/runtime", nil))
+		var stats map[string]any
+		assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &stats))
+		assert.Contains(t, stats, "numGoroutine")
+
+		res = httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/debug/pprof/nonexistent", nil))
+		assert.Equal(t, http.StatusNotFound, res.Code)
+	})
+
+	t.Run("nothing is registered on the default mux", func(t *testing.T) {
+		for _, path := range []string{"/debug/pprof/", "/debug/pprof/cmdline", "/debug/vars"} {
+			_, pattern := http.DefaultServeMux.Handler(httptest.NewRequest(http.MethodGet, path, nil))
+			assert.Empty(t, pattern, path)
+		}
+	})
+
+	t.Run("requests must satisfy the verifier, if configured", func(t *testing.T) {
+		h := newAdminHandler(AdminConfig{
+			Verifier: &mockVerifier{wantHeader: "let-me-in"},
+		})
+
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/debug/runtime", nil))
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+
+		req := httptest.NewRequest(http.MethodGet, "/debug/runtime", nil)
+		req.Header.Set("x-secret", "let-me-in")
+		res = httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		assert.Equal(t, http.StatusOK, res.Code)
+	})
+}
+
+func Test_NewAdminServer(t *testing.T) {
+	s := NewAdminServer(AdminConfig{ListenPort: 6060})
+	assert.Equal(t, DefaultAdminBindAddr, s.(*adminServer).bindAddr)
+}
+
+func Test_WithAdminServer(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	port := getFreePort(t)
+	adminPort := getFreePort(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() {
+		result <- RunServers(ctx, logger, NewHTTPServer(http.NotFoundHandler(), "127.0.0.1", port, WithAdminServer(AdminConfig{
+			ListenPort: adminPort,
+		})))
+	}()
+
+	// RunServers should start the admin server alongside the server that requested it
+	waitForPort(t, adminPort)
+	res, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/debug/buildinfo", adminPort))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	res.Body.Close()
+
+	cancel()
+	select {
+	case err := <-result:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for servers to shut down")
+	}
+}
+
+type mockVerifier struct {
+	wantHeader string
+}
+
+func (m *mockVerifier) Verify(req *http.Request, body []byte) error {
+	if req.Header.Get("x-secret") != m.wantHeader {
+		return errors.New("bad secret")
+	}
+	return nil
+}
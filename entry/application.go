@@ -2,39 +2,159 @@ package entry
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+
+	"golang.org/x/sync/errgroup"
 )
 
 type Application interface {
 	Log() *slog.Logger
 	Fail(message string, err error)
+
+	// Stop cancels the application context and waits for all workers started via Go to
+	// return. If any worker failed, the process then exits with status 1, so that
+	// supervisors see the failure even if the server shut down cleanly in response.
 	Stop()
+
+	// Go runs a long-lived background worker (e.g. a queue consumer) in a new
+	// goroutine, passing it the application context. If the worker returns a non-nil
+	// error, the application context is canceled with that error as its cause, which
+	// will bring down any running server. Stop waits for all workers to return.
+	Go(name string, f func(ctx context.Context) error)
+
+	// LogLevel returns the LevelVar that controls which messages are written by the
+	// application's logger; it may be adjusted at any time
+	LogLevel() *slog.LevelVar
+
+	// LogLevelHandler returns an HTTP handler that reports the current log level in
+	// response to GET requests, and changes it in response to PUT or POST requests
+	// whose body is the name of the new level. It should only be exposed on an
+	// internal/admin listener.
+	LogLevelHandler() http.Handler
+}
+
+// ApplicationOption customizes the behavior of an Application created via
+// NewApplication
+type ApplicationOption func(*applicationConfig)
+
+// WithLogLevel sets the minimum level of log messages written by the application, in
+// lieu of the default of slog.LevelInfo. The LOG_LEVEL environment variable, if set,
+// takes precedence.
+func WithLogLevel(level slog.Level) ApplicationOption {
+	return func(c *applicationConfig) {
+		c.level = level
+	}
+}
+
+// WithLogFormat sets the format of log messages written by the application, in lieu of
+// the default of LogFormatJSON. The LOG_FORMAT environment variable, if set, takes
+// precedence.
+func WithLogFormat(format LogFormat) ApplicationOption {
+	return func(c *applicationConfig) {
+		c.format = format
+	}
+}
+
+// WithLogOutput directs log messages to the given writers instead of os.Stdout: to
+// retain stdout logging in addition to some other sink, include os.Stdout explicitly
+func WithLogOutput(outputs ...io.Writer) ApplicationOption {
+	return func(c *applicationConfig) {
+		c.outputs = append(c.outputs, outputs...)
+	}
+}
+
+// WithLogAttrs attaches additional attributes (e.g. a version number or git SHA) to
+// every message written by the application's logger; args are interpreted as in
+// slog.Logger.With
+func WithLogAttrs(args ...any) ApplicationOption {
+	return func(c *applicationConfig) {
+		c.attrs = append(c.attrs, args...)
+	}
 }
 
-func NewApplication(name string) (Application, context.Context) {
+// applicationConfig accumulates the settings specified via ApplicationOption values
+type applicationConfig struct {
+	level   slog.Level
+	format  LogFormat
+	outputs []io.Writer
+	attrs   []any
+}
+
+func NewApplication(name string, opts ...ApplicationOption) (Application, context.Context) {
+	// Resolve our configuration from the supplied options, allowing environment
+	// variables to override the log level and format
+	config := applicationConfig{
+		level:  slog.LevelInfo,
+		format: LogFormatJSON,
+	}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	if len(config.outputs) == 0 {
+		config.outputs = []io.Writer{os.Stdout}
+	}
+	var envErrs []error
+	if s := os.Getenv(EnvLogLevel); s != "" {
+		if level, err := ParseLogLevel(s); err != nil {
+			envErrs = append(envErrs, err)
+		} else {
+			config.level = level
+		}
+	}
+	if s := os.Getenv(EnvLogFormat); s != "" {
+		if format, err := ParseLogFormat(s); err != nil {
+			envErrs = append(envErrs, err)
+		} else {
+			config.format = format
+		}
+	}
+
 	// Prepare a logger that we can write structured log messages to
 	pid := os.Getpid()
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil)).With(
+	level := &slog.LevelVar{}
+	level.Set(config.level)
+	logger := slog.New(newLogHandler(config.format, level, config.outputs)).With(
 		"pid", pid,
 		"application", name,
 	)
+	if len(config.attrs) > 0 {
+		logger = logger.With(config.attrs...)
+	}
+	for _, err := range envErrs {
+		logger.Warn("Ignoring invalid logging configuration from environment", "error", err)
+	}
 	logger.Info("Process starting")
 
-	// Shut down cleanly on signal
-	ctx, close := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill, syscall.SIGTERM)
+	// Shut down cleanly on signal, and allow worker failures to cancel the application
+	// context with a cause
+	signalCtx, close := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill, syscall.SIGTERM)
+	ctx, cancel := context.WithCancelCause(signalCtx)
 
 	return &application{
+		ctx:      ctx,
+		cancel:   cancel,
 		closeCtx: close,
 		logger:   logger,
+		level:    level,
+		exit:     os.Exit,
 	}, ctx
 }
 
 type application struct {
+	ctx      context.Context
+	cancel   context.CancelCauseFunc
 	closeCtx context.CancelFunc
 	logger   *slog.Logger
+	level    *slog.LevelVar
+	workers  errgroup.Group
+	exit     func(code int)
 }
 
 func (a *application) Log() *slog.Logger {
@@ -43,10 +163,64 @@ func (a *application) Log() *slog.Logger {
 
 func (a *application) Fail(message string, err error) {
 	a.logger.Error(message, "error", err)
-	os.Exit(1)
+	a.exit(1)
 }
 
 func (a *application) Stop() {
 	a.logger.Info("Process stopping")
+	a.cancel(nil)
 	a.closeCtx()
+
+	// Block until all background workers have exited; each worker logs its own result.
+	// A worker failure is fatal to the process, even though it will have shut down the
+	// server cleanly.
+	if err := a.workers.Wait(); err != nil {
+		a.logger.Error("Process stopped after worker failure", "error", err)
+		a.exit(1)
+		return
+	}
+	a.logger.Info("Process stopped")
+}
+
+func (a *application) Go(name string, f func(ctx context.Context) error) {
+	logger := a.logger.With("worker", name)
+	logger.Info("Starting worker")
+	a.workers.Go(func() error {
+		err := f(a.ctx)
+
+		// A worker that returns context.Canceled after the application has been told to
+		// shut down has exited cleanly
+		if err != nil && a.ctx.Err() != nil && errors.Is(err, context.Canceled) {
+			err = nil
+		}
+
+		// Any other error is fatal to the application: cancel the context so that the
+		// server (and any other workers) will shut down, noting the cause
+		if err != nil {
+			logger.Error("Worker failed", "error", err)
+			err = fmt.Errorf("worker %s failed: %w", name, err)
+			a.cancel(err)
+			return err
+		}
+
+		// A worker that exits without error while the application is still running is
+		// suspicious (e.g. a consumer whose deliveries channel was closed), but not fatal
+		if a.ctx.Err() == nil {
+			logger.Warn("Worker finished while application is still running")
+		} else {
+			logger.Info("Worker finished")
+		}
+		return nil
+	})
+}
+
+func (a *application) LogLevel() *slog.LevelVar {
+	return a.level
+}
+
+func (a *application) LogLevelHandler() http.Handler {
+	return &logLevelHandler{
+		logger: a.logger,
+		level:  a.level,
+	}
 }
@@ -0,0 +1,61 @@
+package entry
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_application_Go(t *testing.T) {
+	t.Run("worker failure cancels the application context with a cause", func(t *testing.T) {
+		var buf bytes.Buffer
+		app, ctx := NewApplication("test", WithLogOutput(&buf))
+		exitCode := -1
+		app.(*application).exit = func(code int) { exitCode = code }
+
+		errBoom := errors.New("boom")
+		app.Go("exploder", func(ctx context.Context) error {
+			return errBoom
+		})
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for application context to be canceled")
+		}
+		assert.ErrorIs(t, context.Cause(ctx), errBoom)
+		assert.ErrorContains(t, context.Cause(ctx), "worker exploder failed")
+
+		app.Stop()
+		assert.Contains(t, buf.String(), `"msg":"Worker failed"`)
+		assert.Contains(t, buf.String(), `"msg":"Process stopped after worker failure"`)
+		assert.Contains(t, buf.String(), `worker exploder failed: boom`)
+		assert.Equal(t, 1, exitCode)
+	})
+
+	t.Run("Stop waits for workers to exit", func(t *testing.T) {
+		var buf bytes.Buffer
+		app, _ := NewApplication("test", WithLogOutput(&buf))
+		exitCode := -1
+		app.(*application).exit = func(code int) { exitCode = code }
+
+		exited := false
+		app.Go("waiter", func(ctx context.Context) error {
+			<-ctx.Done()
+			time.Sleep(5 * time.Millisecond)
+			exited = true
+			return ctx.Err()
+		})
+
+		app.Stop()
+		assert.True(t, exited)
+		assert.Contains(t, buf.String(), `"msg":"Worker finished"`)
+		assert.Contains(t, buf.String(), `"msg":"Process stopped"`)
+		assert.NotContains(t, buf.String(), `"msg":"Worker failed"`)
+		assert.Equal(t, -1, exitCode)
+	})
+}
@@ -0,0 +1,161 @@
+package entry
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig describes the cross-origin requests that a server permits from browser
+// clients (e.g. frontend apps and stream overlays hosted on other origins)
+type CORSConfig struct {
+	// AllowedOrigins lists the origins that may make cross-origin requests, e.g.
+	// 'https://goldenvcr.com'. An entry of the form 'https://*.goldenvcr.com' matches any
+	// subdomain of goldenvcr.com (but not goldenvcr.com itself), and '*' matches any
+	// origin.
+	AllowedOrigins []string
+
+	// AllowedMethods lists the methods permitted in cross-origin requests; if empty,
+	// GET, HEAD and POST are permitted
+	AllowedMethods []string
+
+	// AllowedHeaders lists the request headers that browsers may send in cross-origin
+	// requests; if empty, any headers requested in a preflight request are permitted
+	AllowedHeaders []string
+
+	// ExposedHeaders lists the response headers that browsers should make available to
+	// client code, in addition to X-Request-Id, which is always exposed
+	ExposedHeaders []string
+
+	// AllowCredentials indicates whether browsers may include cookies and other
+	// credentials with cross-origin requests. Credentials are only ever permitted for
+	// origins that are explicitly listed in AllowedOrigins (or matched by a subdomain
+	// pattern): origins that are only matched by '*' are never sent credentials.
+	AllowCredentials bool
+
+	// MaxAge is the duration for which browsers may cache the result of a preflight
+	// request; if zero, browsers apply their own default
+	MaxAge time.Duration
+}
+
+// WithCORS adds CORS middleware, configured as described by config, to the handler
+// chain of an HTTP server
+func WithCORS(config CORSConfig) ServerOption {
+	return func(c *serverConfig) {
+		c.middleware = append(c.middleware, CORS(config))
+	}
+}
+
+// CORS returns middleware that sets CORS response headers for requests from allowed
+// origins, and responds directly to CORS preflight requests
+func CORS(config CORSConfig) func(http.Handler) http.Handler {
+	allowedMethods := config.AllowedMethods
+	if len(allowedMethods) == 0 {
+		allowedMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	}
+	exposedHeaders := append([]string{"x-request-id"}, config.ExposedHeaders...)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Responses vary by origin whether or not this request is cross-origin, so
+			// that caches don't serve a response with the wrong CORS headers
+			w.Header().Add("vary", "origin")
+			origin := r.Header.Get("origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			isPreflight := r.Method == http.MethodOptions && r.Header.Get("access-control-request-method") != ""
+			allowed, wildcard := matchOrigin(config.AllowedOrigins, origin)
+			if !allowed {
+				if isPreflight {
+					Log(r).Warn("Rejecting CORS preflight request from disallowed origin", "origin", origin)
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// The origin is allowed: if that's only because all origins are allowed, we
+			// say so without echoing the origin, and we never permit credentials, since
+			// that would let any site make authenticated requests on a user's behalf
+			if wildcard {
+				w.Header().Set("access-control-allow-origin", "*")
+			} else {
+				w.Header().Set("access-control-allow-origin", origin)
+				if config.AllowCredentials {
+					w.Header().Set("access-control-allow-credentials", "true")
+				}
+			}
+
+			// For a normal cross-origin request, expose our configured headers and allow
+			// the handler to proceed
+			if !isPreflight {
+				w.Header().Set("access-control-expose-headers", strings.Join(exposedHeaders, ", "))
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// For a preflight request, respond immediately, describing what's permitted
+			w.Header().Add("vary", "access-control-request-method")
+			w.Header().Add("vary", "access-control-request-headers")
+			requestedMethod := r.Header.Get("access-control-request-method")
+			if !containsString(allowedMethods, requestedMethod) {
+				Log(r).Warn("Rejecting CORS preflight request for disallowed method", "origin", origin, "requestedMethod", requestedMethod)
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Header().Set("access-control-allow-methods", strings.Join(allowedMethods, ", "))
+			if len(config.AllowedHeaders) > 0 {
+				w.Header().Set("access-control-allow-headers", strings.Join(config.AllowedHeaders, ", "))
+			} else if requestedHeaders := r.Header.Get("access-control-request-headers"); requestedHeaders != "" {
+				w.Header().Set("access-control-allow-headers", requestedHeaders)
+			}
+			if config.MaxAge > 0 {
+				w.Header().Set("access-control-max-age", strconv.Itoa(int(config.MaxAge.Seconds())))
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// matchOrigin returns true if origin matches any of the given patterns, along with
+// whether it was matched only by the '*' wildcard
+func matchOrigin(patterns []string, origin string) (bool, bool) {
+	origin = strings.ToLower(origin)
+	wildcard := false
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if pattern == "*" {
+			wildcard = true
+			continue
+		}
+		if pattern == origin {
+			return true, false
+		}
+
+		// 'https://*.example.com' should match 'https://foo.example.com' and
+		// 'https://foo.bar.example.com', but not 'https://example.com'
+		if scheme, domain, ok := strings.Cut(pattern, "://*."); ok {
+			prefix := scheme + "://"
+			suffix := "." + domain
+			if strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) && len(origin) > len(prefix)+len(suffix) {
+				return true, false
+			}
+		}
+	}
+	return wildcard, wildcard
+}
+
+// containsString returns true if s is present in values, ignoring case
+func containsString(values []string, s string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, s) {
+			return true
+		}
+	}
+	return false
+}
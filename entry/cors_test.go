@@ -0,0 +1,93 @@
+package entry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_CORS(t *testing.T) {
+	handler := CORS(CORSConfig{
+		AllowedOrigins:   []string{"https://goldenvcr.com", "https://*.goldenvcr.com"},
+		AllowedMethods:   []string{http.MethodGet, http.MethodPost},
+		ExposedHeaders:   []string{"x-custom"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	})(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte("ok"))
+	}))
+
+	doRequest := func(method, origin string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/", nil)
+		if origin != "" {
+			req.Header.Set("origin", origin)
+		}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res
+	}
+
+	t.Run("same-origin requests are unaffected", func(t *testing.T) {
+		res := doRequest(http.MethodGet, "", nil)
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Empty(t, res.Header().Get("access-control-allow-origin"))
+	})
+	t.Run("allowed origins receive CORS headers", func(t *testing.T) {
+		for _, origin := range []string{"https://goldenvcr.com", "https://overlays.goldenvcr.com", "https://a.b.goldenvcr.com"} {
+			res := doRequest(http.MethodGet, origin, nil)
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, origin, res.Header().Get("access-control-allow-origin"))
+			assert.Equal(t, "true", res.Header().Get("access-control-allow-credentials"))
+			assert.Equal(t, "x-request-id, x-custom", res.Header().Get("access-control-expose-headers"))
+		}
+	})
+	t.Run("disallowed origins receive no CORS headers", func(t *testing.T) {
+		for _, origin := range []string{"https://evil.com", "http://goldenvcr.com", "https://notgoldenvcr.com", "https://.goldenvcr.com"} {
+			res := doRequest(http.MethodGet, origin, nil)
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Empty(t, res.Header().Get("access-control-allow-origin"), origin)
+		}
+	})
+	t.Run("preflight requests are answered directly", func(t *testing.T) {
+		res := doRequest(http.MethodOptions, "https://overlays.goldenvcr.com", map[string]string{
+			"access-control-request-method":  "POST",
+			"access-control-request-headers": "content-type",
+		})
+		assert.Equal(t, http.StatusNoContent, res.Code)
+		assert.Empty(t, res.Body.String())
+		assert.Equal(t, "GET, POST", res.Header().Get("access-control-allow-methods"))
+		assert.Equal(t, "content-type", res.Header().Get("access-control-allow-headers"))
+		assert.Equal(t, "600", res.Header().Get("access-control-max-age"))
+	})
+	t.Run("preflight requests for disallowed methods are rejected", func(t *testing.T) {
+		res := doRequest(http.MethodOptions, "https://goldenvcr.com", map[string]string{
+			"access-control-request-method": "DELETE",
+		})
+		assert.Equal(t, http.StatusForbidden, res.Code)
+	})
+	t.Run("origins matched only by wildcard are never sent credentials", func(t *testing.T) {
+		handler := CORS(CORSConfig{
+			AllowedOrigins:   []string{"https://goldenvcr.com", "*"},
+			AllowCredentials: true,
+		})(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {}))
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("origin", "https://evil.com")
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		assert.Equal(t, "*", res.Header().Get("access-control-allow-origin"))
+		assert.Empty(t, res.Header().Get("access-control-allow-credentials"))
+
+		req.Header.Set("origin", "https://goldenvcr.com")
+		res = httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		assert.Equal(t, "https://goldenvcr.com", res.Header().Get("access-control-allow-origin"))
+		assert.Equal(t, "true", res.Header().Get("access-control-allow-credentials"))
+	})
+}
@@ -12,8 +12,32 @@
 //			app.Fail("Setup failed", err)
 //		}
 //
+//		app.Go("consumer", func(ctx context.Context) error {
+//			return runSomeConsumer(ctx)
+//		})
+//
 //		h := &somethingThatImplementsHttpHandler{}
 //
 //		entry.RunServer(ctx, app.Log(), h, "", 5000)
 //	}
+//
+// To serve both HTTP and gRPC from the same process, use RunServers in lieu of RunServer:
+//
+//	err := entry.RunServers(ctx, app.Log(),
+//		entry.NewHTTPServer(h, "", 5000),
+//		entry.NewGRPCServer(grpcServer, "", 5001),
+//	)
+//
+// Diagnostic endpoints (pprof, runtime stats, etc.) can be served on a separate admin
+// listener, bound to localhost by default:
+//
+//	entry.RunServer(ctx, app.Log(), h, "", 5000, entry.WithAdminServer(entry.AdminConfig{
+//		ListenPort: 6060,
+//		Handlers:   map[string]http.Handler{"/loglevel": app.LogLevelHandler()},
+//	}))
+//
+// By default, log messages are written to stdout as JSON, at Info level and above. The
+// level and format may be configured via options to NewApplication (e.g.
+// entry.WithLogLevel, entry.WithLogFormat), and overridden at deploy time via the
+// LOG_LEVEL and LOG_FORMAT environment variables.
 package entry
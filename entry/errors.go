@@ -0,0 +1,217 @@
+package entry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Error is an error that's reported to clients in a structured, machine-readable form.
+// HTTP handlers can report an Error via WriteError, and gRPC handlers can return one
+// directly (since it implements GRPCStatus) or convert it via ToGRPCError.
+type Error struct {
+	// Status is the HTTP status code for the response; if it's not a valid status code
+	// (e.g. if it's left unset), 500 Internal Server Error is used instead
+	Status int
+
+	// GRPCCode is the gRPC status code used when the error is returned from a gRPC
+	// handler; if codes.OK, a code is derived from Status
+	GRPCCode codes.Code
+
+	// Code is a short, stable, machine-readable identifier, e.g. 'verification_failed'
+	Code string
+
+	// Message is a human-readable description of the error, which is shown to clients
+	Message string
+
+	// Details optionally carries additional JSON-serializable data about the error
+	Details map[string]any
+
+	// Err is the underlying cause of the error: it's logged, but never sent to clients
+	Err error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// GRPCStatus allows an *Error to be returned directly from a gRPC handler, in which case
+// it's reported to the client with an equivalent gRPC status code and message
+func (e *Error) GRPCStatus() *status.Status {
+	code := e.GRPCCode
+	if code == codes.OK {
+		code = grpcCodeFromHTTPStatus(e.Status)
+	}
+	return status.New(code, e.Message)
+}
+
+// errorResponse is the JSON representation of an Error as written by WriteError
+type errorResponse struct {
+	Code      string         `json:"code"`
+	Message   string         `json:"message"`
+	RequestId string         `json:"requestId,omitempty"`
+	Details   map[string]any `json:"details,omitempty"`
+}
+
+// registeredError associates a sentinel error value with the Error that's reported to
+// clients when that error occurs
+type registeredError struct {
+	target error
+	e      Error
+}
+
+var (
+	registeredErrorsMu sync.RWMutex
+	registeredErrors   = []registeredError{
+		{context.DeadlineExceeded, Error{Status: http.StatusGatewayTimeout, Code: "deadline_exceeded", Message: "request timed out"}},
+		{context.Canceled, Error{Status: 499, GRPCCode: codes.Canceled, Code: "canceled", Message: "request canceled"}},
+	}
+)
+
+// RegisterError records the Error that should be reported to clients whenever an error
+// matching target (per errors.Is) is passed to WriteError or ToGRPCError. Packages that
+// export sentinel errors should call RegisterError from an init function.
+func RegisterError(target error, e Error) {
+	registeredErrorsMu.Lock()
+	defer registeredErrorsMu.Unlock()
+
+	registeredErrors = append(registeredErrors, registeredError{target: target, e: e})
+}
+
+// ResolveError converts any error into an *Error that can be reported to a client: err
+// is returned as-is if it's already an *Error (or wraps one); otherwise, if it matches
+// an error registered via RegisterError, a copy of the registered Error is returned,
+// with err as its cause. Any other error is treated as an opaque internal error.
+func ResolveError(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+
+	registeredErrorsMu.RLock()
+	defer registeredErrorsMu.RUnlock()
+	for _, r := range registeredErrors {
+		if errors.Is(err, r.target) {
+			resolved := r.e
+			resolved.Err = err
+			return &resolved
+		}
+	}
+	return &Error{
+		Status:  http.StatusInternalServerError,
+		Code:    "internal_error",
+		Message: "internal server error",
+		Err:     err,
+	}
+}
+
+// WriteError responds to an HTTP request with the given error, resolved via
+// ResolveError. The response body is a JSON object with 'code', 'message',
+// 'requestId', and (if present) 'details' fields, unless the client's Accept header
+// excludes JSON, in which case the message is written as plain text.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	e := ResolveError(err)
+	statusCode := e.Status
+	if statusCode < 100 || statusCode > 599 {
+		statusCode = http.StatusInternalServerError
+	}
+	if e.Err != nil {
+		Log(r).Debug("Writing error response", "status", statusCode, "code", e.Code, "error", e.Err)
+	}
+
+	w.Header().Set("x-content-type-options", "nosniff")
+	if !acceptsJSON(r.Header.Get("accept")) {
+		w.Header().Set("content-type", "text/plain; charset=utf-8")
+		w.WriteHeader(statusCode)
+		fmt.Fprintln(w, e.Message)
+		return
+	}
+
+	requestId, _ := r.Context().Value("x-request-id").(string)
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(errorResponse{
+		Code:      e.Code,
+		Message:   e.Message,
+		RequestId: requestId,
+		Details:   e.Details,
+	})
+}
+
+// ToGRPCError converts any error into a gRPC status error, using the same resolution
+// rules as WriteError. Errors that already carry a gRPC status are returned unchanged.
+func ToGRPCError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if !errors.As(err, &e) {
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+	}
+	return ResolveError(err).GRPCStatus().Err()
+}
+
+// acceptsJSON returns true if a client with the given Accept header will accept a JSON
+// response: clients that don't specify a preference are assumed to accept JSON
+func acceptsJSON(accept string) bool {
+	if accept == "" {
+		return true
+	}
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, _, _ := strings.Cut(mediaRange, ";")
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+		if mediaType == "*/*" || mediaType == "application/*" || mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+			return true
+		}
+	}
+	return false
+}
+
+// grpcCodeFromHTTPStatus returns the gRPC status code most closely corresponding to the
+// given HTTP status code
+func grpcCodeFromHTTPStatus(status int) codes.Code {
+	switch status {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusPreconditionFailed:
+		return codes.FailedPrecondition
+	case http.StatusTooManyRequests, http.StatusRequestEntityTooLarge:
+		return codes.ResourceExhausted
+	case 499:
+		return codes.Canceled
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+	if status >= 400 && status < 500 {
+		return codes.InvalidArgument
+	}
+	return codes.Internal
+}
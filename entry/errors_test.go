@@ -0,0 +1,130 @@
+package entry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errTestWidgetNotFound = errors.New("widget not found")
+
+func init() {
+	RegisterError(errTestWidgetNotFound, Error{
+		Status:  http.StatusNotFound,
+		Code:    "widget_not_found",
+		Message: "no such widget",
+	})
+}
+
+func Test_WriteError(t *testing.T) {
+	doRequest := func(accept string, err error) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req = req.WithContext(context.WithValue(req.Context(), "x-request-id", "some-request-id"))
+		if accept != "" {
+			req.Header.Set("accept", accept)
+		}
+		res := httptest.NewRecorder()
+		WriteError(res, req, err)
+		return res
+	}
+
+	t.Run("Error is written as JSON", func(t *testing.T) {
+		res := doRequest("", &Error{
+			Status:  http.StatusConflict,
+			Code:    "already_exists",
+			Message: "widget already exists",
+			Details: map[string]any{"widgetId": 42},
+		})
+		assert.Equal(t, http.StatusConflict, res.Code)
+		assert.Equal(t, "application/json", res.Header().Get("content-type"))
+		assert.JSONEq(t, `{"code":"already_exists","message":"widget already exists","requestId":"some-request-id","details":{"widgetId":42}}`, res.Body.String())
+	})
+	t.Run("plain text is written if client doesn't accept JSON", func(t *testing.T) {
+		res := doRequest("text/plain, text/html;q=0.9", &Error{
+			Status:  http.StatusBadRequest,
+			Code:    "bad_widget",
+			Message: "widget is malformed",
+		})
+		assert.Equal(t, http.StatusBadRequest, res.Code)
+		assert.Equal(t, "text/plain; charset=utf-8", res.Header().Get("content-type"))
+		assert.Equal(t, "widget is malformed\n", res.Body.String())
+	})
+	t.Run("registered errors are mapped, even when wrapped", func(t *testing.T) {
+		res := doRequest("application/json", fmt.Errorf("failed to load: %w", errTestWidgetNotFound))
+		assert.Equal(t, http.StatusNotFound, res.Code)
+		assert.JSONEq(t, `{"code":"widget_not_found","message":"no such widget","requestId":"some-request-id"}`, res.Body.String())
+	})
+	t.Run("unknown errors are not leaked to the client", func(t *testing.T) {
+		res := doRequest("*/*", errors.New("pq: password authentication failed"))
+		assert.Equal(t, http.StatusInternalServerError, res.Code)
+		assert.NotContains(t, res.Body.String(), "pq:")
+	})
+	t.Run("invalid status codes are reported as internal errors", func(t *testing.T) {
+		for _, status := range []int{0, 42, 600} {
+			res := doRequest("", &Error{Status: status, Code: "oops", Message: "something went wrong"})
+			assert.Equal(t, http.StatusInternalServerError, res.Code)
+			assert.JSONEq(t, `{"code":"oops","message":"something went wrong","requestId":"some-request-id"}`, res.Body.String())
+		}
+	})
+}
+
+func Test_ToGRPCError(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantCode    codes.Code
+		wantMessage string
+	}{
+		{
+			"nil error is passed through",
+			nil,
+			codes.OK,
+			"",
+		},
+		{
+			"Error is converted",
+			&Error{Status: http.StatusForbidden, Message: "nope"},
+			codes.PermissionDenied,
+			"nope",
+		},
+		{
+			"explicit gRPC code takes precedence",
+			&Error{Status: http.StatusBadRequest, GRPCCode: codes.OutOfRange, Message: "too big"},
+			codes.OutOfRange,
+			"too big",
+		},
+		{
+			"registered error is converted",
+			fmt.Errorf("lookup: %w", errTestWidgetNotFound),
+			codes.NotFound,
+			"no such widget",
+		},
+		{
+			"existing status error is passed through",
+			status.Error(codes.Unavailable, "try later"),
+			codes.Unavailable,
+			"try later",
+		},
+		{
+			"unknown error is internal",
+			errors.New("secret details"),
+			codes.Internal,
+			"internal server error",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ToGRPCError(tt.err)
+			s, _ := status.FromError(err)
+			assert.Equal(t, tt.wantCode, s.Code())
+			assert.Equal(t, tt.wantMessage, s.Message())
+		})
+	}
+}
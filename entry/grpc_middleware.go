@@ -7,6 +7,7 @@ import (
 
 	"github.com/google/uuid"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
@@ -35,6 +36,9 @@ func GRPCServerLogging(logger *slog.Logger) grpc.UnaryServerInterceptor {
 			"grpcMethod", info.FullMethod,
 			"remoteAddr", remoteAddr,
 		)
+		if identity := grpcClientIdentity(ctx); identity != "" {
+			logger = logger.With("clientIdentity", identity)
+		}
 		logger.Debug("Handling request")
 
 		// Handle the request, measuring how long it takes to execute
@@ -61,6 +65,28 @@ func GRPCServerLogging(logger *slog.Logger) grpc.UnaryServerInterceptor {
 	}
 }
 
+// GRPCServerErrors converts errors returned by gRPC handlers via ToGRPCError, so that
+// sentinel errors registered via RegisterError are reported to clients with the
+// appropriate status code. It should be chained after GRPCServerLogging so that the
+// final status code is logged.
+func GRPCServerErrors() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		m, err := handler(ctx, req)
+		return m, ToGRPCError(err)
+	}
+}
+
+// grpcClientIdentity returns the identity of the client that made a gRPC request, if
+// the server verified a client certificate via TLS credentials
+func grpcClientIdentity(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok {
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(tlsInfo.State.PeerCertificates) > 0 {
+			return clientIdentity(tlsInfo.State.PeerCertificates[0])
+		}
+	}
+	return ""
+}
+
 func Logger(ctx context.Context) *slog.Logger {
 	if logger, ok := ctx.Value("logger").(*slog.Logger); ok {
 		return logger
@@ -4,46 +4,80 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
-	"net"
 	"os"
 
-	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc"
 )
 
 // RunServer blocks while a gRPC server application runs
-func RunGRPCServer(ctx context.Context, logger *slog.Logger, s *grpc.Server, bindAddr string, listenPort uint16) {
+func RunGRPCServer(ctx context.Context, logger *slog.Logger, s *grpc.Server, bindAddr string, listenPort uint16, opts ...ServerOption) {
+	if err := RunServers(ctx, logger, NewGRPCServer(s, bindAddr, listenPort, opts...)); err != nil {
+		logger.Error("Error running server", "error", err)
+		os.Exit(1)
+	}
+}
+
+// NewGRPCServer prepares a gRPC server to listen on the given address once run via
+// RunServers. WithTLS is not supported for gRPC servers: to serve TLS, create s with the
+// option returned by GRPCServerCredentials.
+func NewGRPCServer(s *grpc.Server, bindAddr string, listenPort uint16, opts ...ServerOption) Server {
+	return &grpcServer{
+		server:     s,
+		bindAddr:   bindAddr,
+		listenPort: listenPort,
+		config:     newServerConfig(opts),
+	}
+}
+
+// grpcServer is the Server implementation returned by NewGRPCServer
+type grpcServer struct {
+	server     *grpc.Server
+	bindAddr   string
+	listenPort uint16
+	config     serverConfig
+}
+
+func (s *grpcServer) adminConfig() *AdminConfig {
+	return s.config.admin
+}
+
+func (s *grpcServer) Serve(ctx context.Context, logger *slog.Logger) error {
+	// A TLS listener would hide the client's certificate from gRPC, so TLS must instead
+	// be configured via transport credentials when the grpc.Server is created
+	addr := fmt.Sprintf("%s:%d", s.bindAddr, s.listenPort)
+	if s.config.tls != nil {
+		err := fmt.Errorf("WithTLS is not supported for gRPC servers; create the grpc.Server with entry.GRPCServerCredentials instead")
+		logger.Error(fmt.Sprintf("Failed to listen on %s", addr), "error", err)
+		return err
+	}
+
 	// Bind to the configured port and begin listening for TCP connections
-	addr := fmt.Sprintf("%s:%d", bindAddr, listenPort)
-	listenConfig := net.ListenConfig{}
-	lis, err := listenConfig.Listen(ctx, "tcp", addr)
+	lis, err := s.config.listen(ctx, logger, addr)
 	if err != nil {
 		logger.Error(fmt.Sprintf("Failed to listen on %s", addr), "error", err)
-		os.Exit(1)
+		return err
 	}
 
 	// Kick off a goroutine which calls s.Serve
-	var wg errgroup.Group
-	wg.Go(func() error { return s.Serve(lis) })
+	logger.Info("Now listening for gRPC", "bindAddr", s.bindAddr, "listenPort", s.listenPort)
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- s.server.Serve(lis) }()
 
 	// Block indefinitely, running the server all the while, until our application-level
-	// context is done
+	// context is done (or until the server fails on its own)
 	select {
 	case <-ctx.Done():
-		cancelErr := context.Cause(ctx)
-		if cancelErr != nil && cancelErr != ctx.Err() {
-			logger.Error("Closing server due to application error", "error", cancelErr)
-		} else {
-			logger.Info("Application is shutting down cleanly; closing server")
-		}
-		s.GracefulStop()
+		logShutdownReason(ctx, logger)
+		s.server.GracefulStop()
+	case err := <-serveErr:
+		serveErr <- err
 	}
 
 	// Block until s.Serve returns so we can ensure that the server is closed
-	err = wg.Wait()
+	err = <-serveErr
 	if err != nil {
-		logger.Error("Error running server", "error", err)
-		os.Exit(1)
+		return fmt.Errorf("error running gRPC server on %s: %w", addr, err)
 	}
 	logger.Info("Server closed")
+	return nil
 }
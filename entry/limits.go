@@ -0,0 +1,145 @@
+package entry
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+)
+
+// HTTPTimeouts configures the limits that an HTTP server imposes on each connection,
+// in order to guard against slow or idle clients tying up server resources. Fields
+// have the same semantics as the corresponding fields of http.Server: in particular, a
+// zero duration means no timeout.
+type HTTPTimeouts struct {
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+}
+
+// DefaultHTTPTimeouts are the limits applied to HTTP servers unless overridden via
+// WithHTTPTimeouts. Handlers that serve long-lived streaming responses (such as
+// sse.Handler) should call DisableTimeouts to exempt themselves from the read and
+// write timeouts.
+var DefaultHTTPTimeouts = HTTPTimeouts{
+	ReadHeaderTimeout: 10 * time.Second,
+	ReadTimeout:       60 * time.Second,
+	WriteTimeout:      60 * time.Second,
+	IdleTimeout:       120 * time.Second,
+	MaxHeaderBytes:    64 << 10,
+}
+
+// WithHTTPTimeouts replaces DefaultHTTPTimeouts with the given values for an HTTP
+// server
+func WithHTTPTimeouts(timeouts HTTPTimeouts) ServerOption {
+	return func(c *serverConfig) {
+		c.httpTimeouts = &timeouts
+	}
+}
+
+// apply copies our configured values onto the given http.Server
+func (t *HTTPTimeouts) apply(server *http.Server) {
+	server.ReadHeaderTimeout = t.ReadHeaderTimeout
+	server.ReadTimeout = t.ReadTimeout
+	server.WriteTimeout = t.WriteTimeout
+	server.IdleTimeout = t.IdleTimeout
+	server.MaxHeaderBytes = t.MaxHeaderBytes
+}
+
+// DisableTimeouts clears the server-imposed read and write deadlines for the
+// connection serving the current request, so that a handler may stream a response
+// indefinitely. Returns an error (which may safely be ignored) if the underlying
+// ResponseWriter doesn't support deadlines, as is the case in tests.
+func DisableTimeouts(w http.ResponseWriter) error {
+	rc := http.NewResponseController(w)
+	if err := rc.SetReadDeadline(time.Time{}); err != nil {
+		return err
+	}
+	return rc.SetWriteDeadline(time.Time{})
+}
+
+// LimitRequestBody returns middleware that caps the size of request bodies accepted by
+// the wrapped handler. Requests that declare a Content-Length greater than maxBytes are
+// rejected immediately with 413 Request Entity Too Large. Bodies without a declared
+// length are cut off once they exceed maxBytes: the handler will receive an error from
+// its next call to Read, and the response status will be forced to 413.
+func LimitRequestBody(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > maxBytes {
+				Log(r).Warn("Rejecting request with oversized body", "contentLength", r.ContentLength, "maxBytes", maxBytes)
+				WriteError(w, r, &Error{
+					Status:  http.StatusRequestEntityTooLarge,
+					Code:    "request_too_large",
+					Message: "request body is too large",
+					Details: map[string]any{"maxBytes": maxBytes},
+				})
+				return
+			}
+
+			lw := &limitedBodyResponseWriter{ResponseWriter: w}
+			r.Body = &limitedBody{
+				ReadCloser: http.MaxBytesReader(w, r.Body, maxBytes),
+				onExceeded: func() {
+					Log(r).Warn("Request body exceeded limit", "maxBytes", maxBytes)
+					lw.exceeded = true
+				},
+			}
+			next.ServeHTTP(lw, r)
+		})
+	}
+}
+
+// limitedBody wraps the reader returned by http.MaxBytesReader in order to notify us
+// when the limit is exceeded
+type limitedBody struct {
+	io.ReadCloser
+	onExceeded func()
+	notified   bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	var maxBytesErr *http.MaxBytesError
+	if err != nil && !b.notified && errors.As(err, &maxBytesErr) {
+		b.notified = true
+		b.onExceeded()
+	}
+	return n, err
+}
+
+// limitedBodyResponseWriter overrides the response status with 413 if the request
+// body was found to exceed its limit before the handler wrote a response
+type limitedBodyResponseWriter struct {
+	http.ResponseWriter
+	exceeded      bool
+	headerWritten bool
+}
+
+func (w *limitedBodyResponseWriter) WriteHeader(status int) {
+	if !w.headerWritten && w.exceeded {
+		status = http.StatusRequestEntityTooLarge
+	}
+	w.headerWritten = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *limitedBodyResponseWriter) Write(data []byte) (int, error) {
+	if !w.headerWritten {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *limitedBodyResponseWriter) Flush() {
+	if !w.headerWritten {
+		w.WriteHeader(http.StatusOK)
+	}
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (w *limitedBodyResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
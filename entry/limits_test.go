@@ -0,0 +1,90 @@
+package entry
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_LimitRequestBody(t *testing.T) {
+	handler := LimitRequestBody(8)(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		data, err := io.ReadAll(req.Body)
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+		res.Write(data)
+	}))
+
+	t.Run("body within limit is passed through", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("hello"))
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, "hello", res.Body.String())
+	})
+	t.Run("oversized Content-Length is rejected up front", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("hello world"))
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, res.Code)
+	})
+	t.Run("oversized body of unknown length results in 413", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/", io.MultiReader(strings.NewReader("hello world")))
+		req.ContentLength = -1
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, res.Code)
+	})
+}
+
+func Test_DisableTimeouts(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handler := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/stream" {
+			assert.NoError(t, DisableTimeouts(res))
+		}
+		res.WriteHeader(http.StatusOK)
+		res.(http.Flusher).Flush()
+		for i := 0; i < 3; i++ {
+			time.Sleep(40 * time.Millisecond)
+			fmt.Fprintf(res, "tick %d\n", i)
+			res.(http.Flusher).Flush()
+		}
+	})
+
+	port := getFreePort(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go RunServers(ctx, logger, NewHTTPServer(handler, "127.0.0.1", port, WithHTTPTimeouts(HTTPTimeouts{
+		ReadTimeout:  50 * time.Millisecond,
+		WriteTimeout: 50 * time.Millisecond,
+	})))
+	waitForPort(t, port)
+
+	countTicks := func(path string) int {
+		res, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d%s", port, path))
+		if err != nil {
+			return 0
+		}
+		defer res.Body.Close()
+		n := 0
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			n++
+		}
+		return n
+	}
+
+	assert.Less(t, countTicks("/"), 3)
+	assert.Equal(t, 3, countTicks("/stream"))
+}
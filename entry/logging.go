@@ -0,0 +1,105 @@
+package entry
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// LogFormat identifies the format in which an Application writes its log messages
+type LogFormat string
+
+const (
+	// LogFormatJSON writes each log message as a single line of JSON, suitable for
+	// ingestion by log aggregators in deployed environments
+	LogFormatJSON LogFormat = "json"
+
+	// LogFormatText writes each log message as a human-readable line of key=value pairs,
+	// suitable for reading in a terminal during local development
+	LogFormatText LogFormat = "text"
+)
+
+const (
+	// EnvLogLevel is the name of an environment variable that, if set, overrides the
+	// log level configured for an Application: valid values are 'debug', 'info',
+	// 'warn', and 'error' (case-insensitive)
+	EnvLogLevel = "LOG_LEVEL"
+
+	// EnvLogFormat is the name of an environment variable that, if set, overrides the
+	// log format configured for an Application: valid values are 'json' and 'text'
+	EnvLogFormat = "LOG_FORMAT"
+)
+
+// ParseLogLevel converts a string such as 'debug' or 'WARN' into the corresponding
+// slog.Level
+func ParseLogLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(s))); err != nil {
+		return slog.LevelInfo, fmt.Errorf("invalid log level '%s'", s)
+	}
+	return level, nil
+}
+
+// ParseLogFormat converts a string such as 'json' or 'text' into a LogFormat
+func ParseLogFormat(s string) (LogFormat, error) {
+	format := LogFormat(strings.ToLower(strings.TrimSpace(s)))
+	if format != LogFormatJSON && format != LogFormatText {
+		return LogFormatJSON, fmt.Errorf("invalid log format '%s' (expected json|text)", s)
+	}
+	return format, nil
+}
+
+// newLogHandler initializes an slog.Handler that writes messages in the given format
+// to all of the provided writers, filtering out any messages below the level recorded
+// in the given LevelVar
+func newLogHandler(format LogFormat, level *slog.LevelVar, outputs []io.Writer) slog.Handler {
+	var w io.Writer
+	if len(outputs) == 1 {
+		w = outputs[0]
+	} else {
+		w = io.MultiWriter(outputs...)
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	if format == LogFormatText {
+		return slog.NewTextHandler(w, opts)
+	}
+	return slog.NewJSONHandler(w, opts)
+}
+
+// logLevelHandler is an HTTP handler that allows an application's log level to be
+// inspected (via GET) and adjusted at runtime (via PUT or POST, with the new level
+// name as the request body)
+type logLevelHandler struct {
+	logger *slog.Logger
+	level  *slog.LevelVar
+}
+
+func (h *logLevelHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		res.Header().Set("content-type", "text/plain")
+		fmt.Fprintf(res, "%s\n", h.level.Level())
+	case http.MethodPut, http.MethodPost:
+		data, err := io.ReadAll(io.LimitReader(req.Body, 64))
+		if err != nil {
+			http.Error(res, "failed to read request body", http.StatusBadRequest)
+			return
+		}
+		level, err := ParseLogLevel(string(data))
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+		prev := h.level.Level()
+		h.level.Set(level)
+		h.logger.Warn("Log level changed at runtime", "previousLevel", prev, "newLevel", level)
+		res.Header().Set("content-type", "text/plain")
+		fmt.Fprintf(res, "%s\n", level)
+	default:
+		res.Header().Set("allow", "GET, PUT, POST")
+		http.Error(res, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,93 @@
+package entry
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseLogLevel(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    slog.Level
+		wantErr bool
+	}{
+		{"debug", slog.LevelDebug, false},
+		{"INFO", slog.LevelInfo, false},
+		{" warn\n", slog.LevelWarn, false},
+		{"Error", slog.LevelError, false},
+		{"verbose", slog.LevelInfo, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := ParseLogLevel(tt.s)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_newLogHandler(t *testing.T) {
+	t.Run("text format is human-readable", func(t *testing.T) {
+		var buf bytes.Buffer
+		level := &slog.LevelVar{}
+		logger := slog.New(newLogHandler(LogFormatText, level, []io.Writer{&buf}))
+		logger.Info("hello", "foo", "bar")
+		assert.Contains(t, buf.String(), `msg=hello foo=bar`)
+	})
+	t.Run("messages are fanned out to all outputs", func(t *testing.T) {
+		var a, b bytes.Buffer
+		level := &slog.LevelVar{}
+		logger := slog.New(newLogHandler(LogFormatJSON, level, []io.Writer{&a, &b}))
+		logger.Info("hello")
+		assert.Contains(t, a.String(), `"msg":"hello"`)
+		assert.Equal(t, a.String(), b.String())
+	})
+	t.Run("messages below the current level are discarded", func(t *testing.T) {
+		var buf bytes.Buffer
+		level := &slog.LevelVar{}
+		logger := slog.New(newLogHandler(LogFormatJSON, level, []io.Writer{&buf}))
+		logger.Debug("not logged")
+		assert.Empty(t, buf.String())
+		level.Set(slog.LevelDebug)
+		logger.Debug("logged")
+		assert.Contains(t, buf.String(), `"msg":"logged"`)
+	})
+}
+
+func Test_logLevelHandler(t *testing.T) {
+	level := &slog.LevelVar{}
+	h := &logLevelHandler{
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		level:  level,
+	}
+
+	t.Run("GET reports the current level", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, "INFO\n", res.Body.String())
+	})
+	t.Run("PUT changes the level", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodPut, "/", strings.NewReader("debug")))
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, slog.LevelDebug, level.Level())
+	})
+	t.Run("invalid level is rejected", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodPut, "/", strings.NewReader("loud")))
+		assert.Equal(t, http.StatusBadRequest, res.Code)
+		assert.Equal(t, slog.LevelDebug, level.Level())
+	})
+}
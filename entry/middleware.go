@@ -12,8 +12,10 @@ import (
 // Middleware injects HTTP response handler logic to facilitate tracing and logging:
 // every incoming request will receive an X-Request-Id header (accessible via a context
 // value) and a customized slog.Logger instance (also stored in the request context, and
-// accessible via entry.Log()), and all requests will be logged
-func Middleware(logger *slog.Logger) func(http.Handler) http.Handler {
+// accessible via entry.Log()), and all requests will be logged, subject to any
+// sampling and redaction rules specified via opts
+func Middleware(logger *slog.Logger, opts ...AccessLogOption) func(http.Handler) http.Handler {
+	config := newAccessLogConfig(opts)
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Generate a unique ID for this request, if it doesn't already have one
@@ -26,9 +28,12 @@ func Middleware(logger *slog.Logger) func(http.Handler) http.Handler {
 			reqLogger := logger.With(
 				"requestId", requestId,
 				"method", r.Method,
-				"path", r.URL.Path,
+			).With(config.requestAttrs(r)...).With(
 				"remoteAddr", r.RemoteAddr,
 			)
+			if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+				reqLogger = reqLogger.With("clientIdentity", clientIdentity(r.TLS.PeerCertificates[0]))
+			}
 			reqLogger.Debug("Handling request")
 
 			// Inject the request ID and logger into the request context, so that HTTP
@@ -51,16 +56,24 @@ func Middleware(logger *slog.Logger) func(http.Handler) http.Handler {
 			elapsed := time.Since(start)
 			elapsedMilliseconds := float64(elapsed.Nanoseconds()) / float64(1000000)
 
-			// Write a final log message indicating that the request is finished
+			// Write a final log message indicating that the request is finished, unless
+			// it succeeded and our sampling rules say to skip it
+			sampleRate := config.sampleRate(r.URL.Path)
+			if !config.shouldLog(recorder.status, sampleRate) {
+				return
+			}
 			level := slog.LevelError
 			if recorder.status >= 100 && recorder.status <= 499 {
 				level = slog.LevelInfo
 			}
-			reqLogger.Log(nil, level,
-				"Request finished",
+			attrs := []any{
 				"elapsedMilliseconds", elapsedMilliseconds,
 				"status", recorder.status,
-			)
+			}
+			if sampleRate < 1 {
+				attrs = append(attrs, "sampleRate", sampleRate)
+			}
+			reqLogger.Log(nil, level, "Request finished", attrs...)
 		})
 	}
 }
@@ -111,3 +124,8 @@ func (r *statusRecorder) WriteHeader(status int) {
 func (r *statusRecorder) Flush() {
 	r.ResponseWriter.(http.Flusher).Flush()
 }
+
+// Unwrap exposes the underlying ResponseWriter to http.ResponseController
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
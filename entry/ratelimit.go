@@ -0,0 +1,217 @@
+package entry
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// RateLimit describes a token-bucket rate limit: each client may make up to Burst
+// requests in quick succession, after which further requests are permitted at a
+// sustained rate of Rate requests per second
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// RateLimiter tracks a separate token bucket for each client, keyed by an arbitrary
+// string (e.g. a client IP address). A single RateLimiter may be shared by several
+// routes to give them a common limit, or each route may be given its own.
+type RateLimiter struct {
+	limit RateLimit
+	now   func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// tokenBucket records the number of tokens available to a single client as of a
+// particular time
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// rateLimitSweepInterval is how often a RateLimiter discards state for clients whose
+// buckets have refilled completely, to keep memory usage bounded
+const rateLimitSweepInterval = time.Minute
+
+// NewRateLimiter initializes a RateLimiter that enforces the given limit. An error is
+// returned if the limit's Rate or Burst is not positive, since a client that exhausted
+// such a bucket could never be told when to retry.
+func NewRateLimiter(limit RateLimit) (*RateLimiter, error) {
+	if limit.Rate <= 0 {
+		return nil, fmt.Errorf("rate limit must have a positive Rate; got %v", limit.Rate)
+	}
+	if limit.Burst < 1 {
+		return nil, fmt.Errorf("rate limit must have a Burst of at least 1; got %d", limit.Burst)
+	}
+	return &RateLimiter{
+		limit:   limit,
+		now:     time.Now,
+		buckets: make(map[string]*tokenBucket),
+	}, nil
+}
+
+// take attempts to consume a token from the bucket for the given key, returning true if
+// the request should be allowed, along with the number of tokens remaining and the
+// duration until another token will become available
+func (l *RateLimiter) take(key string) (bool, int, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(l.limit.Burst), updated: now}
+		l.buckets[key] = b
+	} else {
+		elapsed := now.Sub(b.updated).Seconds()
+		b.tokens = math.Min(float64(l.limit.Burst), b.tokens+elapsed*l.limit.Rate)
+		b.updated = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, int(b.tokens), l.untilNextToken(b)
+	}
+	return false, 0, l.untilNextToken(b)
+}
+
+// untilNextToken returns the time until the given bucket will next hold a whole token
+func (l *RateLimiter) untilNextToken(b *tokenBucket) time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / l.limit.Rate * float64(time.Second))
+}
+
+// sweep discards any buckets that would be full by now, since they're equivalent to a
+// newly-created bucket
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*l.limit.Rate >= float64(l.limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// RateLimitKeyFunc identifies the client that made an HTTP request, for the purposes
+// of rate limiting
+type RateLimitKeyFunc func(r *http.Request) string
+
+// KeyByRemoteAddr identifies clients by IP address
+func KeyByRemoteAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// KeyByHeader identifies clients by the value of the given request header (e.g. an API
+// key, or a client IP header set by a trusted proxy), falling back to the remote
+// address for requests that don't carry the header
+func KeyByHeader(name string) RateLimitKeyFunc {
+	return func(r *http.Request) string {
+		if value := r.Header.Get(name); value != "" {
+			return value
+		}
+		return KeyByRemoteAddr(r)
+	}
+}
+
+// LimitRate returns middleware that enforces the given RateLimiter's limit for each
+// client, as identified by key. Every response carries X-RateLimit-Limit,
+// X-RateLimit-Remaining and X-RateLimit-Reset headers; requests in excess of the limit
+// are rejected with 429 Too Many Requests and a Retry-After header.
+func LimitRate(l *RateLimiter, key RateLimitKeyFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			k := key(r)
+			ok, remaining, reset := l.take(k)
+
+			w.Header().Set("x-ratelimit-limit", strconv.Itoa(l.limit.Burst))
+			w.Header().Set("x-ratelimit-remaining", strconv.Itoa(remaining))
+			w.Header().Set("x-ratelimit-reset", formatSeconds(reset))
+			if !ok {
+				Log(r).Warn("Request rejected due to rate limit", "rateLimitKey", k, "retryAfter", reset.String())
+				w.Header().Set("retry-after", formatSeconds(reset))
+				WriteError(w, r, &Error{
+					Status:  http.StatusTooManyRequests,
+					Code:    "rate_limited",
+					Message: "too many requests",
+				})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// GRPCRateLimitKeyFunc identifies the client that made a gRPC request, for the purposes
+// of rate limiting
+type GRPCRateLimitKeyFunc func(ctx context.Context, info *grpc.UnaryServerInfo) string
+
+// GRPCKeyByPeerAddr identifies gRPC clients by IP address
+func GRPCKeyByPeerAddr(ctx context.Context, info *grpc.UnaryServerInfo) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// GRPCKeyByMetadata identifies gRPC clients by the value of the given metadata key,
+// falling back to the peer address for requests that don't carry it
+func GRPCKeyByMetadata(name string) GRPCRateLimitKeyFunc {
+	return func(ctx context.Context, info *grpc.UnaryServerInfo) string {
+		if values := metadata.ValueFromIncomingContext(ctx, name); len(values) > 0 && values[0] != "" {
+			return values[0]
+		}
+		return GRPCKeyByPeerAddr(ctx, info)
+	}
+}
+
+// GRPCServerRateLimit is the gRPC equivalent of LimitRate: requests in excess of the
+// limit are rejected with codes.ResourceExhausted, and a retry-after header is sent.
+// It should be chained after GRPCServerLogging so that rejections are logged.
+func GRPCServerRateLimit(l *RateLimiter, key GRPCRateLimitKeyFunc) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		k := key(ctx, info)
+		ok, _, reset := l.take(k)
+		if !ok {
+			Logger(ctx).Warn("Request rejected due to rate limit", "rateLimitKey", k, "retryAfter", reset.String())
+			grpc.SetHeader(ctx, metadata.Pairs("retry-after", formatSeconds(reset)))
+			return nil, status.Error(codes.ResourceExhausted, "rate limit exceeded")
+		}
+		return handler(ctx, req)
+	}
+}
+
+// formatSeconds formats a duration as a whole number of seconds, rounding up
+func formatSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
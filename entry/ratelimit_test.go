@@ -0,0 +1,105 @@
+package entry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func Test_RateLimiter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l, err := NewRateLimiter(RateLimit{Rate: 2, Burst: 3})
+	assert.NoError(t, err)
+	l.now = func() time.Time { return now }
+
+	// A new client may make up to Burst requests at once
+	for i := 2; i >= 0; i-- {
+		ok, remaining, _ := l.take("a")
+		assert.True(t, ok)
+		assert.Equal(t, i, remaining)
+	}
+	ok, _, retryAfter := l.take("a")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, retryAfter)
+
+	// Other clients have their own buckets
+	ok, _, _ = l.take("b")
+	assert.True(t, ok)
+
+	// Tokens are replenished at the configured rate
+	now = now.Add(500 * time.Millisecond)
+	ok, _, _ = l.take("a")
+	assert.True(t, ok)
+	ok, _, _ = l.take("a")
+	assert.False(t, ok)
+
+	// Idle buckets are eventually discarded
+	now = now.Add(rateLimitSweepInterval)
+	l.take("c")
+	assert.Len(t, l.buckets, 1)
+}
+
+func Test_NewRateLimiter(t *testing.T) {
+	t.Run("limit without a sustained rate is rejected", func(t *testing.T) {
+		_, err := NewRateLimiter(RateLimit{Rate: 0, Burst: 10})
+		assert.ErrorContains(t, err, "positive Rate")
+	})
+	t.Run("limit without a burst is rejected", func(t *testing.T) {
+		_, err := NewRateLimiter(RateLimit{Rate: 1, Burst: 0})
+		assert.ErrorContains(t, err, "Burst of at least 1")
+	})
+}
+
+func Test_LimitRate(t *testing.T) {
+	l, err := NewRateLimiter(RateLimit{Rate: 1, Burst: 1})
+	assert.NoError(t, err)
+	handler := LimitRate(l, KeyByHeader("x-api-key"))(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusNoContent)
+	}))
+
+	doRequest := func(apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("x-api-key", apiKey)
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res
+	}
+
+	res := doRequest("foo")
+	assert.Equal(t, http.StatusNoContent, res.Code)
+	assert.Equal(t, "1", res.Header().Get("x-ratelimit-limit"))
+	assert.Equal(t, "0", res.Header().Get("x-ratelimit-remaining"))
+
+	res = doRequest("foo")
+	assert.Equal(t, http.StatusTooManyRequests, res.Code)
+	assert.Equal(t, "1", res.Header().Get("retry-after"))
+
+	res = doRequest("bar")
+	assert.Equal(t, http.StatusNoContent, res.Code)
+}
+
+func Test_GRPCServerRateLimit(t *testing.T) {
+	l, err := NewRateLimiter(RateLimit{Rate: 1, Burst: 1})
+	assert.NoError(t, err)
+	interceptor := GRPCServerRateLimit(l, GRPCKeyByMetadata("x-api-key"))
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return "ok", nil
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-api-key", "foo"))
+	res, err := interceptor(ctx, nil, info, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", res)
+
+	_, err = interceptor(ctx, nil, info, handler)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
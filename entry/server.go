@@ -2,51 +2,88 @@ package entry
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"log/slog"
 	"net/http"
 	"os"
-
-	"golang.org/x/sync/errgroup"
 )
 
 // RunServer blocks while an HTTP server application runs
-func RunServer(ctx context.Context, logger *slog.Logger, handler http.Handler, bindAddr string, listenPort uint16) {
+func RunServer(ctx context.Context, logger *slog.Logger, handler http.Handler, bindAddr string, listenPort uint16, opts ...ServerOption) {
+	if err := RunServers(ctx, logger, NewHTTPServer(handler, bindAddr, listenPort, opts...)); err != nil {
+		logger.Error("error running server", "error", err)
+		os.Exit(1)
+	}
+}
+
+// NewHTTPServer prepares an HTTP server, with reasonable default config, that will
+// serve requests using the given handler once run via RunServers
+func NewHTTPServer(handler http.Handler, bindAddr string, listenPort uint16, opts ...ServerOption) Server {
+	return &httpServer{
+		handler:    handler,
+		bindAddr:   bindAddr,
+		listenPort: listenPort,
+		config:     newServerConfig(opts),
+	}
+}
+
+// httpServer is the Server implementation returned by NewHTTPServer
+type httpServer struct {
+	handler    http.Handler
+	bindAddr   string
+	listenPort uint16
+	config     serverConfig
+}
+
+func (s *httpServer) adminConfig() *AdminConfig {
+	return s.config.admin
+}
+
+func (s *httpServer) Serve(ctx context.Context, logger *slog.Logger) error {
 	// Prepare an http.Server with reasonable default config, using our provided handler
-	addr := fmt.Sprintf("%s:%d", bindAddr, listenPort)
+	addr := fmt.Sprintf("%s:%d", s.bindAddr, s.listenPort)
 	server := &http.Server{
 		Addr:     addr,
-		Handler:  Middleware(logger)(handler),
+		Handler:  Middleware(logger, s.config.accessLog...)(s.config.wrapHandler(s.handler)),
 		ErrorLog: NewErrorLog(*logger),
 	}
+	timeouts := &DefaultHTTPTimeouts
+	if s.config.httpTimeouts != nil {
+		timeouts = s.config.httpTimeouts
+	}
+	timeouts.apply(server)
 
-	// Kick off a goroutine which calls server.ListenAndServe()
-	logger.Info("Now listening", "bindAddr", bindAddr, "listenPort", listenPort)
-	var wg errgroup.Group
-	wg.Go(server.ListenAndServe)
+	// Bind to the configured port and begin listening for TCP connections
+	lis, err := s.config.listen(ctx, logger, addr, "h2", "http/1.1")
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to listen on %s", addr), "error", err)
+		return err
+	}
+
+	// Kick off a goroutine which calls server.Serve()
+	logger.Info("Now listening", "bindAddr", s.bindAddr, "listenPort", s.listenPort, "tls", s.config.tls != nil)
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- server.Serve(lis) }()
 
 	// Block indefinitely, running the server all the while, until our application-level
-	// context is done
+	// context is done (or until the server fails on its own)
 	select {
 	case <-ctx.Done():
-		cancelErr := context.Cause(ctx)
-		if cancelErr != nil && cancelErr != ctx.Err() {
-			logger.Error("Closing server due to application error", "error", cancelErr)
-		} else {
-			logger.Info("Application is shutting down cleanly; closing server")
-		}
+		logShutdownReason(ctx, logger)
 		server.Shutdown(context.Background())
+	case err := <-serveErr:
+		serveErr <- err
 	}
 
-	// Block until ListenAndServe returns so we can ensure that the server is closed
-	err := wg.Wait()
-	if err == http.ErrServerClosed {
+	// Block until Serve returns so we can ensure that the server is closed
+	err = <-serveErr
+	if errors.Is(err, http.ErrServerClosed) {
 		logger.Info("Server closed")
-	} else {
-		logger.Error("error running server", "error", err)
-		os.Exit(1)
+		return nil
 	}
+	return fmt.Errorf("error running HTTP server on %s: %w", addr, err)
 }
 
 // NewErrorLog adapts an slog.Logger to the simpler log.Logger interface used by
@@ -0,0 +1,129 @@
+package entry
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Server is a network server that can be run alongside other servers in the same
+// process via RunServers
+type Server interface {
+	// Serve binds to the server's configured address and blocks while serving requests,
+	// until either ctx is done (in which case the server is shut down gracefully and nil
+	// is returned) or the server fails
+	Serve(ctx context.Context, logger *slog.Logger) error
+}
+
+// RunServers runs any number of servers (e.g. an HTTP server created with
+// NewHTTPServer and a gRPC server created with NewGRPCServer) concurrently, blocking
+// until all of them have shut down. All servers are shut down together once ctx is
+// done, or as soon as any one of them fails. Unlike RunServer and RunGRPCServer,
+// RunServers does not exit the process: it returns the first error that caused a
+// server to fail, or nil if all servers were closed cleanly. An admin server is run
+// alongside any server that was created with WithAdminServer.
+func RunServers(ctx context.Context, logger *slog.Logger, servers ...Server) error {
+	servers = withAdminServers(servers)
+
+	// Derive a context that we can cancel (with a cause) if any server fails, so that
+	// the remaining servers will log the reason for their shutdown
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	var wg errgroup.Group
+	for _, s := range servers {
+		wg.Go(func() error {
+			err := s.Serve(ctx, logger)
+			cancel(err)
+			return err
+		})
+	}
+	return wg.Wait()
+}
+
+// logShutdownReason writes a log message explaining why a server is being closed, once
+// its application-level context is done
+func logShutdownReason(ctx context.Context, logger *slog.Logger) {
+	cancelErr := context.Cause(ctx)
+	if cancelErr != nil && cancelErr != ctx.Err() {
+		logger.Error("Closing server due to application error", "error", cancelErr)
+	} else {
+		logger.Info("Application is shutting down cleanly; closing server")
+	}
+}
+
+// ServerOption customizes the behavior of a server run via RunServer, RunGRPCServer,
+// or RunServers
+type ServerOption func(*serverConfig)
+
+// serverConfig accumulates the settings specified via ServerOption values
+type serverConfig struct {
+	tls          *TLSConfig
+	httpTimeouts *HTTPTimeouts
+	middleware   []func(http.Handler) http.Handler
+	admin        *AdminConfig
+	accessLog    []AccessLogOption
+}
+
+// newServerConfig resolves the configuration specified by a set of ServerOptions
+func newServerConfig(opts []ServerOption) serverConfig {
+	var c serverConfig
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// adminConfigurable is implemented by servers that accept WithAdminServer
+type adminConfigurable interface {
+	adminConfig() *AdminConfig
+}
+
+// withAdminServers returns the given servers, followed by an admin server for each one
+// that was configured via WithAdminServer
+func withAdminServers(servers []Server) []Server {
+	result := append([]Server(nil), servers...)
+	for _, s := range servers {
+		if c, ok := s.(adminConfigurable); ok && c.adminConfig() != nil {
+			result = append(result, NewAdminServer(*c.adminConfig()))
+		}
+	}
+	return result
+}
+
+// wrapHandler applies any configured middleware to an HTTP handler, such that the first
+// middleware added is the outermost
+func (c *serverConfig) wrapHandler(handler http.Handler) http.Handler {
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		handler = c.middleware[i](handler)
+	}
+	return handler
+}
+
+// listen binds to the given address and begins listening for TCP connections, wrapping
+// the listener to serve TLS if so configured
+func (c *serverConfig) listen(ctx context.Context, logger *slog.Logger, addr string, nextProtos ...string) (net.Listener, error) {
+	var tlsConfig *tls.Config
+	if c.tls != nil {
+		var err error
+		tlsConfig, err = NewServerTLSConfig(*c.tls, logger, nextProtos...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	listenConfig := net.ListenConfig{}
+	lis, err := listenConfig.Listen(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	if tlsConfig != nil {
+		lis = tls.NewListener(lis, tlsConfig)
+	}
+	return lis, nil
+}
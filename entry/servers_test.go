@@ -0,0 +1,98 @@
+package entry
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+)
+
+func Test_RunServers(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	t.Run("HTTP and gRPC servers run together and shut down together", func(t *testing.T) {
+		httpPort := getFreePort(t)
+		grpcPort := getFreePort(t)
+		handler := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			res.Write([]byte("ok"))
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		result := make(chan error, 1)
+		go func() {
+			result <- RunServers(ctx, logger,
+				NewHTTPServer(handler, "127.0.0.1", httpPort),
+				NewGRPCServer(grpc.NewServer(), "127.0.0.1", grpcPort),
+			)
+		}()
+
+		// Both servers should start accepting connections
+		waitForPort(t, httpPort)
+		waitForPort(t, grpcPort)
+		res, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/", httpPort))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		res.Body.Close()
+
+		// Canceling the context should close both servers cleanly
+		cancel()
+		select {
+		case err := <-result:
+			assert.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for servers to shut down")
+		}
+	})
+
+	t.Run("failure of one server shuts down the others and returns an error", func(t *testing.T) {
+		// Occupy a port so that the gRPC server will be unable to bind to it
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		defer lis.Close()
+		takenPort := uint16(lis.Addr().(*net.TCPAddr).Port)
+
+		result := make(chan error, 1)
+		go func() {
+			result <- RunServers(context.Background(), logger,
+				NewHTTPServer(http.NotFoundHandler(), "127.0.0.1", getFreePort(t)),
+				NewGRPCServer(grpc.NewServer(), "127.0.0.1", takenPort),
+			)
+		}()
+
+		select {
+		case err := <-result:
+			assert.ErrorContains(t, err, "failed to listen")
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for servers to shut down")
+		}
+	})
+}
+
+func getFreePort(t *testing.T) uint16 {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find free port: %v", err)
+	}
+	defer lis.Close()
+	return uint16(lis.Addr().(*net.TCPAddr).Port)
+}
+
+func waitForPort(t *testing.T, port uint16) {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err == nil {
+			conn.Close()
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for port %d", port)
+}
@@ -0,0 +1,221 @@
+package entry
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// DefaultTLSReloadInterval is the default frequency with which certificate files are
+// checked for changes while a TLS-enabled server is running
+const DefaultTLSReloadInterval = 30 * time.Second
+
+// TLSConfig describes the files from which a server loads the certificates it uses to
+// serve TLS, and optionally to verify client certificates (i.e. mTLS). Files are
+// checked for changes periodically, so certificates may be rotated on disk without
+// restarting the server.
+type TLSConfig struct {
+	// CertFile and KeyFile are paths to the PEM-encoded certificate chain and private
+	// key that the server presents to clients
+	CertFile string
+	KeyFile  string
+
+	// ClientCAFile, if non-empty, is the path to a PEM-encoded bundle of CA
+	// certificates: when set, every client must present a certificate signed by one of
+	// these CAs
+	ClientCAFile string
+
+	// ReloadInterval is the minimum duration between checks for changes to the above
+	// files; if zero, DefaultTLSReloadInterval is used
+	ReloadInterval time.Duration
+}
+
+// WithTLS configures an HTTP server to serve TLS (or mTLS, if config.ClientCAFile is
+// set) using the given certificate files. gRPC servers use GRPCServerCredentials
+// instead.
+func WithTLS(config TLSConfig) ServerOption {
+	return func(c *serverConfig) {
+		c.tls = &config
+	}
+}
+
+// NewServerTLSConfig loads the files described by config and returns a tls.Config that
+// reloads them whenever they change. WithTLS (for HTTP servers) and
+// GRPCServerCredentials (for gRPC servers) are sufficient for most purposes.
+func NewServerTLSConfig(config TLSConfig, logger *slog.Logger, nextProtos ...string) (*tls.Config, error) {
+	r, err := newCertReloader(config, logger)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: nextProtos,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, clientCAs := r.current()
+			c := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				NextProtos:   nextProtos,
+				Certificates: []tls.Certificate{*cert},
+			}
+			if clientCAs != nil {
+				c.ClientCAs = clientCAs
+				c.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+			return c, nil
+		},
+	}, nil
+}
+
+// GRPCServerCredentials loads the files described by config and returns a
+// grpc.ServerOption that configures a gRPC server to serve TLS (or mTLS, if
+// config.ClientCAFile is set), reloading the files whenever they change. gRPC servers
+// must be configured with this option when they're created, rather than via WithTLS, so
+// that each client's verified certificate is available to GRPCServerLogging.
+func GRPCServerCredentials(config TLSConfig, logger *slog.Logger) (grpc.ServerOption, error) {
+	// The config returned for each connection replaces the one given to
+	// credentials.NewTLS, so it must advertise HTTP/2 via ALPN itself
+	tlsConfig, err := NewServerTLSConfig(config, logger, "h2")
+	if err != nil {
+		return nil, err
+	}
+	return grpc.Creds(credentials.NewTLS(tlsConfig)), nil
+}
+
+// certReloader holds the most recently-loaded server certificate and client CA pool
+// for a TLSConfig, reloading them from disk when the underlying files are modified
+type certReloader struct {
+	config TLSConfig
+	logger *slog.Logger
+
+	mu          sync.Mutex
+	cert        *tls.Certificate
+	clientCAs   *x509.CertPool
+	modTimes    []time.Time
+	lastChecked time.Time
+}
+
+func newCertReloader(config TLSConfig, logger *slog.Logger) (*certReloader, error) {
+	if config.CertFile == "" || config.KeyFile == "" {
+		return nil, fmt.Errorf("TLS config must specify both CertFile and KeyFile")
+	}
+	if config.ReloadInterval == 0 {
+		config.ReloadInterval = DefaultTLSReloadInterval
+	}
+	r := &certReloader{
+		config: config,
+		logger: logger,
+	}
+	modTimes, err := r.statFiles()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(modTimes); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// current returns the certificate and CA pool that should be used for a new TLS
+// handshake, first reloading them if ReloadInterval has elapsed and any of the files
+// have changed on disk. If reloading fails, the previously-loaded values are retained.
+func (r *certReloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.lastChecked) >= r.config.ReloadInterval {
+		r.lastChecked = time.Now()
+		modTimes, err := r.statFiles()
+		if err != nil {
+			r.logger.Warn("Failed to check TLS certificate files for changes", "error", err)
+		} else if r.hasChanged(modTimes) {
+			if err := r.load(modTimes); err != nil {
+				r.logger.Error("Failed to reload TLS certificates; continuing to use previous certificates", "error", err)
+			} else {
+				r.logger.Info("Reloaded TLS certificates", "certFile", r.config.CertFile)
+			}
+		}
+	}
+	return r.cert, r.clientCAs
+}
+
+// files returns the paths of all files that we need to load
+func (r *certReloader) files() []string {
+	files := []string{r.config.CertFile, r.config.KeyFile}
+	if r.config.ClientCAFile != "" {
+		files = append(files, r.config.ClientCAFile)
+	}
+	return files
+}
+
+// statFiles returns the modification times of all files, in the order returned by
+// files()
+func (r *certReloader) statFiles() ([]time.Time, error) {
+	files := r.files()
+	modTimes := make([]time.Time, 0, len(files))
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat %s: %w", file, err)
+		}
+		modTimes = append(modTimes, info.ModTime())
+	}
+	return modTimes, nil
+}
+
+// hasChanged returns true if any of the given modification times differ from those
+// recorded when the files were last loaded
+func (r *certReloader) hasChanged(modTimes []time.Time) bool {
+	for i := range modTimes {
+		if !modTimes[i].Equal(r.modTimes[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// load reads all files from disk, replacing our current values if successful
+func (r *certReloader) load(modTimes []time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.config.CertFile, r.config.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS key pair: %w", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if r.config.ClientCAFile != "" {
+		data, err := os.ReadFile(r.config.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no valid certificates found in client CA file %s", r.config.ClientCAFile)
+		}
+	}
+
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.modTimes = modTimes
+	return nil
+}
+
+// clientIdentity returns a string that identifies the client that presented the given
+// certificate: the subject's common name if set, otherwise its first URI or DNS SAN
+func clientIdentity(cert *x509.Certificate) string {
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+	if len(cert.URIs) > 0 {
+		return cert.URIs[0].String()
+	}
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+	return cert.Subject.String()
+}
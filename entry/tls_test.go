@@ -0,0 +1,265 @@
+package entry
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func Test_WithTLS(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certFile, keyFile := ca.issue(t, dir, "server", 1)
+	caFile := ca.writeCert(t, dir)
+	clientCert := ca.issueKeyPair(t, "ledger-service", 2)
+
+	t.Run("HTTP server with client CA requires and logs client certificates", func(t *testing.T) {
+		var buf syncBuffer
+		logger := slog.New(slog.NewJSONHandler(&buf, nil))
+		port := getFreePort(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		result := make(chan error, 1)
+		go func() {
+			handler := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				res.Write([]byte("ok"))
+			})
+			result <- RunServers(ctx, logger, NewHTTPServer(handler, "127.0.0.1", port, WithTLS(TLSConfig{
+				CertFile:     certFile,
+				KeyFile:      keyFile,
+				ClientCAFile: caFile,
+			})))
+		}()
+		waitForPort(t, port)
+		url := fmt.Sprintf("https://127.0.0.1:%d/", port)
+
+		// A client that doesn't present a certificate should be rejected
+		anonymousClient := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: ca.pool()},
+		}}
+		_, err := anonymousClient.Get(url)
+		assert.Error(t, err)
+
+		// A client with a valid certificate should be served, and its identity should
+		// be recorded in the request logs
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: ca.pool(), Certificates: []tls.Certificate{clientCert}},
+		}}
+		res, err := client.Get(url)
+		assert.NoError(t, err)
+		if err == nil {
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+			res.Body.Close()
+		}
+
+		cancel()
+		assert.NoError(t, <-result)
+		assert.Contains(t, buf.String(), `"clientIdentity":"ledger-service"`)
+	})
+
+	t.Run("gRPC server with client CA requires and logs client certificates", func(t *testing.T) {
+		var buf syncBuffer
+		logger := slog.New(slog.NewJSONHandler(&buf, nil))
+		creds, err := GRPCServerCredentials(TLSConfig{
+			CertFile:     certFile,
+			KeyFile:      keyFile,
+			ClientCAFile: caFile,
+		}, logger)
+		assert.NoError(t, err)
+		s := grpc.NewServer(creds, grpc.UnaryInterceptor(GRPCServerLogging(logger)))
+		healthpb.RegisterHealthServer(s, health.NewServer())
+
+		lis := bufconn.Listen(1024 * 1024)
+		go s.Serve(lis)
+		defer s.Stop()
+		dial := func(tlsConfig *tls.Config) healthpb.HealthClient {
+			conn, err := grpc.NewClient("passthrough:///server",
+				grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+					return lis.DialContext(ctx)
+				}),
+				grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)),
+			)
+			assert.NoError(t, err)
+			t.Cleanup(func() { conn.Close() })
+			return healthpb.NewHealthClient(conn)
+		}
+
+		// A client that doesn't present a certificate should be rejected
+		_, err = dial(&tls.Config{RootCAs: ca.pool(), ServerName: "127.0.0.1"}).Check(context.Background(), &healthpb.HealthCheckRequest{})
+		assert.Error(t, err)
+
+		// A client with a valid certificate should be served, and its identity should
+		// be recorded in the request logs
+		client := dial(&tls.Config{RootCAs: ca.pool(), ServerName: "127.0.0.1", Certificates: []tls.Certificate{clientCert}})
+		res, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+		assert.NoError(t, err)
+		assert.Equal(t, healthpb.HealthCheckResponse_SERVING, res.GetStatus())
+		assert.Contains(t, buf.String(), `"clientIdentity":"ledger-service"`)
+	})
+
+	t.Run("gRPC server rejects WithTLS", func(t *testing.T) {
+		logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+		server := NewGRPCServer(grpc.NewServer(), "127.0.0.1", getFreePort(t), WithTLS(TLSConfig{
+			CertFile: certFile,
+			KeyFile:  keyFile,
+		}))
+		err := RunServers(context.Background(), logger, server)
+		assert.ErrorContains(t, err, "GRPCServerCredentials")
+	})
+}
+
+func Test_certReloader(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certFile, keyFile := ca.issue(t, dir, "server", 100)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	r, err := newCertReloader(TLSConfig{
+		CertFile:       certFile,
+		KeyFile:        keyFile,
+		ReloadInterval: time.Nanosecond,
+	}, logger)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(100), leafSerial(t, r))
+
+	// Replacing the certificate on disk should cause it to be reloaded
+	ca.issue(t, dir, "server", 200)
+	touch(t, time.Now().Add(time.Minute), certFile, keyFile)
+	assert.Equal(t, int64(200), leafSerial(t, r))
+
+	// Writing an invalid certificate should leave the previous certificate in use
+	assert.NoError(t, os.WriteFile(certFile, []byte("garbage"), 0600))
+	touch(t, time.Now().Add(2*time.Minute), certFile)
+	assert.Equal(t, int64(200), leafSerial(t, r))
+}
+
+// testCA is a throwaway certificate authority used to issue certificates in tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return &testCA{cert: cert, key: key, der: der}
+}
+
+func (ca *testCA) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+func (ca *testCA) writeCert(t *testing.T, dir string) string {
+	path := filepath.Join(dir, "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.der})
+	assert.NoError(t, os.WriteFile(path, data, 0600))
+	return path
+}
+
+// issueDER creates a certificate valid for both server and client auth on 127.0.0.1
+func (ca *testCA) issueDER(t *testing.T, commonName string, serial int64) ([]byte, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	assert.NoError(t, err)
+	return der, key
+}
+
+func (ca *testCA) issue(t *testing.T, dir string, commonName string, serial int64) (string, string) {
+	der, key := ca.issueDER(t, commonName, serial)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	certFile := filepath.Join(dir, commonName+".pem")
+	keyFile := filepath.Join(dir, commonName+"-key.pem")
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile
+}
+
+func (ca *testCA) issueKeyPair(t *testing.T, commonName string, serial int64) tls.Certificate {
+	der, key := ca.issueDER(t, commonName, serial)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func leafSerial(t *testing.T, r *certReloader) int64 {
+	cert, _ := r.current()
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	assert.NoError(t, err)
+	return leaf.SerialNumber.Int64()
+}
+
+// touch sets the modification time of the given files, so that changes are detected
+// even on filesystems with coarse timestamp resolution
+func touch(t *testing.T, modTime time.Time, paths ...string) {
+	for _, path := range paths {
+		assert.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+}
+
+// syncBuffer is a bytes.Buffer that's safe for concurrent use, so that log output
+// written by a server goroutine can be inspected by a test
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
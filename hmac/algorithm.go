@@ -0,0 +1,193 @@
+package hmac
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Algorithm identifies the algorithm used to compute a signature
+type Algorithm string
+
+const (
+	// AlgorithmHMACSHA256 signatures are computed as an HMAC-SHA256 of the signed
+	// message, keyed with a shared secret. This is the default algorithm.
+	AlgorithmHMACSHA256 Algorithm = "sha256"
+
+	// AlgorithmHMACSHA512 signatures are computed as an HMAC-SHA512 of the signed
+	// message, keyed with a shared secret
+	AlgorithmHMACSHA512 Algorithm = "sha512"
+
+	// AlgorithmEd25519 signatures are computed with an Ed25519 private key, and can be
+	// verified with the corresponding public key: this allows verifiers to authenticate
+	// requests without holding any secret that would allow them to sign requests
+	AlgorithmEd25519 Algorithm = "ed25519"
+)
+
+// allAlgorithms lists every supported algorithm, in order of preference
+var allAlgorithms = []Algorithm{AlgorithmEd25519, AlgorithmHMACSHA512, AlgorithmHMACSHA256}
+
+// ParseAlgorithm converts a string such as 'sha512' into an Algorithm
+func ParseAlgorithm(s string) (Algorithm, error) {
+	alg := Algorithm(strings.ToLower(strings.TrimSpace(s)))
+	if !slices.Contains(allAlgorithms, alg) {
+		return "", fmt.Errorf("unsupported signature algorithm '%s'", s)
+	}
+	return alg, nil
+}
+
+// signatureFormat distinguishes the kinds of messages that can be signed, each of which
+// is identified by a different prefix on the signature's label
+type signatureFormat string
+
+const (
+	formatV1   signatureFormat = ""
+	formatV2   signatureFormat = "v2"
+	formatGRPC signatureFormat = "grpc"
+	formatURL  signatureFormat = "url"
+)
+
+// formatForVersion returns the format used to label signatures of the given version
+func formatForVersion(version SignatureVersion) signatureFormat {
+	if version == SignatureV2 {
+		return formatV2
+	}
+	return formatV1
+}
+
+// signature is a single signature carried in HeaderSignature, which is formatted as
+// '<label>=<hex-encoded signature>', where label is the algorithm name, prefixed by
+// the format (if any), e.g. 'sha256=...' or 'v2-ed25519=...'
+type signature struct {
+	format    signatureFormat
+	algorithm Algorithm
+	value     string
+}
+
+func (s signature) String() string {
+	label := string(s.algorithm)
+	if s.format != formatV1 {
+		label = string(s.format) + "-" + label
+	}
+	return label + "=" + s.value
+}
+
+// formatSignatures formats one or more signatures as the value of HeaderSignature
+func formatSignatures(signatures []signature) string {
+	parts := make([]string, 0, len(signatures))
+	for _, sig := range signatures {
+		parts = append(parts, sig.String())
+	}
+	return strings.Join(parts, ",")
+}
+
+// formatSignatureLabels describes the format and algorithm of each of the given
+// signatures (omitting their values), for use in error messages
+func formatSignatureLabels(signatures []signature) string {
+	if len(signatures) == 0 {
+		return "no recognized signatures"
+	}
+	labels := make([]string, 0, len(signatures))
+	for _, sig := range signatures {
+		label, _, _ := strings.Cut(sig.String(), "=")
+		labels = append(labels, label)
+	}
+	return strings.Join(labels, ", ")
+}
+
+// parseSignatures parses the value of HeaderSignature, which may carry several
+// comma-separated signatures (e.g. while signers are migrated between algorithms).
+// Signatures in unrecognized formats are ignored.
+func parseSignatures(value string) []signature {
+	var signatures []signature
+	for _, part := range strings.Split(value, ",") {
+		label, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok || value == "" {
+			continue
+		}
+		format := formatV1
+		if prefix, rest, ok := strings.Cut(label, "-"); ok {
+			format, label = signatureFormat(prefix), rest
+		}
+		if format != formatV1 && format != formatV2 && format != formatGRPC && format != formatURL {
+			continue
+		}
+		alg := Algorithm(label)
+		if !slices.Contains(allAlgorithms, alg) {
+			continue
+		}
+		signatures = append(signatures, signature{format: format, algorithm: alg, value: value})
+	}
+	return signatures
+}
+
+// supportsAlgorithm returns true if the given key holds the material needed to sign or
+// verify a signature using the given algorithm
+func (k Key) supportsAlgorithm(alg Algorithm) bool {
+	if alg == AlgorithmEd25519 {
+		return len(k.PrivateKey) == ed25519.PrivateKeySize || len(k.PublicKey) == ed25519.PublicKeySize
+	}
+	return k.Secret != ""
+}
+
+// computeSignature returns the hex-encoded signature of message, computed with the
+// given key using the given algorithm
+func computeSignature(alg Algorithm, key Key, message []byte) (string, error) {
+	switch alg {
+	case AlgorithmHMACSHA256, AlgorithmHMACSHA512:
+		if key.Secret == "" {
+			return "", fmt.Errorf("key '%s' has no secret for %s signatures", key.ID, alg)
+		}
+		return hex.EncodeToString(computeHMAC(alg, key.Secret, message)), nil
+	case AlgorithmEd25519:
+		if len(key.PrivateKey) != ed25519.PrivateKeySize {
+			return "", fmt.Errorf("key '%s' has no private key for %s signatures", key.ID, alg)
+		}
+		return hex.EncodeToString(ed25519.Sign(key.PrivateKey, message)), nil
+	}
+	return "", fmt.Errorf("unsupported signature algorithm '%s'", alg)
+}
+
+// checkSignatureValue returns true if value is a valid hex-encoded signature of
+// message, computed with the given key using the given algorithm
+func checkSignatureValue(alg Algorithm, key Key, message []byte, value string) bool {
+	switch alg {
+	case AlgorithmHMACSHA256, AlgorithmHMACSHA512:
+		if key.Secret == "" {
+			return false
+		}
+		expected := hex.EncodeToString(computeHMAC(alg, key.Secret, message))
+		return hmac.Equal([]byte(value), []byte(expected))
+	case AlgorithmEd25519:
+		publicKey := key.PublicKey
+		if len(publicKey) == 0 && len(key.PrivateKey) == ed25519.PrivateKeySize {
+			publicKey = key.PrivateKey.Public().(ed25519.PublicKey)
+		}
+		if len(publicKey) != ed25519.PublicKeySize {
+			return false
+		}
+		sig, err := hex.DecodeString(value)
+		if err != nil {
+			return false
+		}
+		return ed25519.Verify(publicKey, message, sig)
+	}
+	return false
+}
+
+// computeHMAC returns the HMAC of message keyed with secret, using the hash function
+// for the given HMAC algorithm
+func computeHMAC(alg Algorithm, secret string, message []byte) []byte {
+	newHash := sha256.New
+	if alg == AlgorithmHMACSHA512 {
+		newHash = sha512.New
+	}
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write(message)
+	return mac.Sum(nil)
+}
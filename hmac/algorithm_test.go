@@ -0,0 +1,117 @@
+package hmac
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseSignatures(t *testing.T) {
+	got := parseSignatures("sha256=aaaa, v2-sha512=bbbb,grpc-ed25519=cccc,md5=dddd,v3-sha256=eeee,sha256=")
+	assert.Equal(t, []signature{
+		{format: formatV1, algorithm: AlgorithmHMACSHA256, value: "aaaa"},
+		{format: formatV2, algorithm: AlgorithmHMACSHA512, value: "bbbb"},
+		{format: formatGRPC, algorithm: AlgorithmEd25519, value: "cccc"},
+	}, got)
+	assert.Equal(t, "sha256=aaaa,v2-sha512=bbbb,grpc-ed25519=cccc", formatSignatures(got))
+}
+
+func Test_Algorithms(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+	body := []byte("hello world")
+
+	sign := func(t *testing.T, s Signer) *http.Request {
+		req, err := http.NewRequest(http.MethodPost, "/somewhere", bytes.NewReader(body))
+		assert.NoError(t, err)
+		req, err = s.Sign(req, body)
+		assert.NoError(t, err)
+		return req
+	}
+
+	t.Run("sha512 signature is computed as expected", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/somewhere", bytes.NewReader(body))
+		assert.NoError(t, err)
+		req.Header.Set(HeaderRequestId, "d6c6a6d0-bb4e-4ff2-8188-4dda238f9223")
+		req.Header.Set(HeaderRequestTimestamp, "2023-12-06T21:06:04+00:00")
+		req, err = NewSigner("my-secret", WithAlgorithms(AlgorithmHMACSHA512), WithInPlaceSigning()).Sign(req, body)
+		assert.NoError(t, err)
+		assert.Equal(t, "sha512=17934cd44ec7f661f2953dde5207d06f3f628feba8905aefbc27e017be3d54cec877c6811098db69201b46f6c352e7ee394803198498caabb5248e5ad7f5e66b", req.Header.Get(HeaderSignature))
+
+		principal, err := NewVerifier("my-secret").(PrincipalVerifier).Authenticate(req, body)
+		assert.NoError(t, err)
+		assert.Equal(t, AlgorithmHMACSHA512, principal.Algorithm)
+	})
+	t.Run("ed25519 signature is verified with public key only", func(t *testing.T) {
+		req := sign(t, NewEd25519Signer(privateKey, WithSignatureV2()))
+		assert.True(t, strings.HasPrefix(req.Header.Get(HeaderSignature), "v2-ed25519="))
+		principal, err := NewEd25519Verifier(publicKey).(PrincipalVerifier).Authenticate(req, body)
+		assert.NoError(t, err)
+		assert.Equal(t, AlgorithmEd25519, principal.Algorithm)
+
+		otherPublicKey, _, err := ed25519.GenerateKey(nil)
+		assert.NoError(t, err)
+		assert.ErrorIs(t, NewEd25519Verifier(otherPublicKey).Verify(req, body), ErrVerificationFailed)
+	})
+	t.Run("ed25519 verifier can't be satisfied with an HMAC signature", func(t *testing.T) {
+		req := sign(t, NewSigner("my-secret"))
+		assert.ErrorIs(t, NewEd25519Verifier(publicKey).Verify(req, body), ErrVerificationFailed)
+	})
+	t.Run("signer can't use an algorithm its key doesn't support", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/somewhere", bytes.NewReader(body))
+		assert.NoError(t, err)
+		_, err = NewSigner("my-secret", WithAlgorithms(AlgorithmEd25519)).Sign(req, body)
+		assert.Error(t, err)
+	})
+	t.Run("verifier policy selects among multiple signatures", func(t *testing.T) {
+		keyring, err := NewKeyring("k1", Key{ID: "k1", Secret: "my-secret", PrivateKey: privateKey})
+		assert.NoError(t, err)
+		s := NewKeyringSigner(keyring, WithAlgorithms(AlgorithmHMACSHA256, AlgorithmEd25519))
+		req := sign(t, s)
+		assert.Len(t, parseSignatures(req.Header.Get(HeaderSignature)), 2)
+
+		tests := []struct {
+			accepted []Algorithm
+			want     Algorithm
+		}{
+			{nil, AlgorithmHMACSHA256},
+			{[]Algorithm{AlgorithmEd25519}, AlgorithmEd25519},
+			{[]Algorithm{AlgorithmHMACSHA512}, ""},
+		}
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("%v", tt.accepted), func(t *testing.T) {
+				v := NewKeyringVerifier(keyring, WithAcceptedAlgorithms(tt.accepted...))
+				principal, err := v.(PrincipalVerifier).Authenticate(req, body)
+				if tt.want == "" {
+					assert.ErrorIs(t, err, ErrVerificationFailed)
+				} else {
+					assert.NoError(t, err)
+					assert.Equal(t, tt.want, principal.Algorithm)
+				}
+			})
+		}
+	})
+	t.Run("invalid signature is rejected even alongside a valid one", func(t *testing.T) {
+		req := sign(t, NewSigner("my-secret", WithAlgorithms(AlgorithmHMACSHA512)))
+		req.Header.Set(HeaderSignature, "sha256=deadbeef,"+req.Header.Get(HeaderSignature))
+		assert.NoError(t, NewVerifier("my-secret").Verify(req, body))
+		assert.ErrorIs(t, NewVerifier("my-secret", WithAcceptedAlgorithms(AlgorithmHMACSHA256)).Verify(req, body), ErrVerificationFailed)
+	})
+	t.Run("keyring can hold ed25519 public keys", func(t *testing.T) {
+		doc := fmt.Sprintf(`{"current":"k1","keys":[{"id":"k1","publicKey":"%s"}]}`, base64.StdEncoding.EncodeToString(publicKey))
+		t.Setenv("TEST_HMAC_KEYRING", doc)
+		keyring, err := LoadKeyringFromEnv("TEST_HMAC_KEYRING")
+		assert.NoError(t, err)
+
+		signerKeyring, err := NewKeyring("k1", Key{ID: "k1", PrivateKey: privateKey})
+		assert.NoError(t, err)
+		req := sign(t, NewKeyringSigner(signerKeyring))
+		assert.NoError(t, NewKeyringVerifier(keyring).Verify(req, body))
+	})
+}
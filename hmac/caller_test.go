@@ -0,0 +1,90 @@
+package hmac
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_CallerVerifier(t *testing.T) {
+	v := NewCallerVerifier(map[string]Caller{
+		"ledger":   {Secret: "ledger-secret", Scopes: []string{"credits:grant", "credits:read"}},
+		"showtime": {Secret: "showtime-secret", Scopes: []string{"credits:read"}},
+	})
+	body := []byte(`{"numCredits":10}`)
+
+	sign := func(t *testing.T, s Signer) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/credits/grant", bytes.NewReader(body))
+		req, err := s.Sign(req, body)
+		assert.NoError(t, err)
+		return req
+	}
+
+	t.Run("caller is identified by its secret", func(t *testing.T) {
+		req := sign(t, NewSigner("ledger-secret", WithCallerId("ledger")))
+		assert.Equal(t, "ledger", req.Header.Get(HeaderCallerId))
+		principal, err := v.(PrincipalVerifier).Authenticate(req, body)
+		assert.NoError(t, err)
+		assert.Equal(t, "ledger", principal.Caller)
+		assert.True(t, principal.HasScopes("credits:grant", "credits:read"))
+	})
+	t.Run("caller can't impersonate another caller", func(t *testing.T) {
+		req := sign(t, NewSigner("showtime-secret", WithCallerId("ledger")))
+		_, err := v.(PrincipalVerifier).Authenticate(req, body)
+		assert.ErrorIs(t, err, ErrVerificationFailed)
+	})
+	t.Run("unknown or missing caller is rejected", func(t *testing.T) {
+		_, err := v.(PrincipalVerifier).Authenticate(sign(t, NewSigner("ledger-secret", WithCallerId("nobody"))), body)
+		assert.ErrorIs(t, err, ErrVerificationFailed)
+		_, err = v.(PrincipalVerifier).Authenticate(sign(t, NewSigner("ledger-secret")), body)
+		assert.ErrorIs(t, err, ErrVerificationFailed)
+	})
+}
+
+func Test_RequireScopes(t *testing.T) {
+	v := NewCallerVerifier(map[string]Caller{
+		"ledger":   {Secret: "ledger-secret", Scopes: []string{"credits:grant"}},
+		"showtime": {Secret: "showtime-secret", Scopes: []string{"credits:read"}},
+	})
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/credits/grant", RequireScopes("credits:grant")(ok))
+	mux.Handle("/credits/balance", RequireScopes("credits:read")(ok))
+	h := Middleware(v)(mux)
+
+	tests := []struct {
+		name       string
+		caller     string
+		secret     string
+		path       string
+		wantStatus int
+	}{
+		{"ledger can grant credits", "ledger", "ledger-secret", "/credits/grant", http.StatusNoContent},
+		{"showtime can't grant credits", "showtime", "showtime-secret", "/credits/grant", http.StatusForbidden},
+		{"showtime can read balances", "showtime", "showtime-secret", "/credits/balance", http.StatusNoContent},
+		{"ledger can't read balances", "ledger", "ledger-secret", "/credits/balance", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, nil)
+			req, err := NewSigner(tt.secret, WithCallerId(tt.caller)).Sign(req, nil)
+			assert.NoError(t, err)
+			res := httptest.NewRecorder()
+			h.ServeHTTP(res, req)
+			assert.Equal(t, tt.wantStatus, res.Code)
+			if tt.wantStatus == http.StatusForbidden {
+				assert.Contains(t, res.Body.String(), `"code":"insufficient_scope"`)
+			}
+		})
+	}
+	t.Run("unverified request is rejected", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		RequireScopes("credits:grant")(ok).ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/credits/grant", nil))
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+	})
+}
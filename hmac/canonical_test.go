@@ -0,0 +1,74 @@
+package hmac
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_canonicalQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"empty query", "", ""},
+		{"params are sorted by name", "b=2&a=1", "a=1&b=2"},
+		{"repeated params are sorted by value", "a=2&b=1&a=1", "a=1&a=2&b=1"},
+		{"names and values are escaped", "q=hello world&x%20y=a%26b", "q=hello+world&x+y=a%26b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, canonicalQuery(query))
+		})
+	}
+}
+
+func Test_messageV2(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, "http://auth.internal/access/grant?scope=b&scope=a", nil)
+	assert.NoError(t, err)
+	req.Header.Set("content-type", "application/json")
+
+	message := messageV2(req, "d6c6a6d0-bb4e-4ff2-8188-4dda238f9223", "2023-12-06T21:06:04+00:00", []string{"content-type", "host"}, sha256Digest([]byte("hello world")))
+	assert.Equal(t, "HMAC-V2\n"+
+		"POST\n"+
+		"/access/grant\n"+
+		"scope=a&scope=b\n"+
+		"d6c6a6d0-bb4e-4ff2-8188-4dda238f9223\n"+
+		"2023-12-06T21:06:04+00:00\n"+
+		"content-type;host\n"+
+		"content-type:application/json\n"+
+		"host:auth.internal\n"+
+		"b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9", string(message))
+}
+
+func Test_CanonicalMessage(t *testing.T) {
+	t.Run("v1 message is the concatenation of ID, timestamp, and body", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/somewhere", nil)
+		assert.NoError(t, err)
+		req.Header.Set(HeaderRequestId, "1234")
+		req.Header.Set(HeaderRequestTimestamp, "2023-12-06T21:06:04+00:00")
+		req.Header.Set(HeaderSignature, "sha256=deadbeef")
+		message, err := CanonicalMessage(req, []byte("hello world"))
+		assert.NoError(t, err)
+		assert.Equal(t, "12342023-12-06T21:06:04+00:00hello world", string(message))
+	})
+	t.Run("v2 message is the canonical request", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/somewhere", nil)
+		assert.NoError(t, err)
+		req.Header.Set(HeaderSignature, "v2-sha256=deadbeef")
+		message, err := CanonicalMessage(req, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "HMAC-V2\nPOST\n/somewhere\n", string(message[:len("HMAC-V2\nPOST\n/somewhere\n")]))
+	})
+	t.Run("unsigned request has no canonical message", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/somewhere", nil)
+		assert.NoError(t, err)
+		_, err = CanonicalMessage(req, nil)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,101 @@
+/*
+The hmac command signs and verifies HMAC-signed requests, for use when debugging calls
+between internal services that fail verification.
+
+Usage:
+
+	go run github.com/golden-vcr/server-common/hmac/cmd <command> [flags]
+
+Commands:
+
+	sign   | Signs a request and prints it as a curl command, or sends it with -send
+	verify | Verifies a captured request, explaining which part of it doesn't match
+
+The shared secret may be supplied via -secret, or via the HMAC_SECRET environment
+variable. Run a command with -h for a full list of its flags.
+
+To sign a request and print a curl command that will send it:
+
+	go run github.com/golden-vcr/server-common/hmac/cmd sign -secret my-secret \
+		-d '{"numCredits":10}' -H 'content-type: application/json' \
+		-v2 -signed-headers content-type http://localhost:5002/credits/grant
+
+To reproduce a signature that was computed previously, pass the original request ID and
+timestamp via -request-id and -timestamp.
+
+To verify a request that was captured (e.g. by a proxy) as raw HTTP/1.1, including its
+request line, headers, and body:
+
+	go run github.com/golden-vcr/server-common/hmac/cmd verify -secret my-secret \
+		-request captured.txt
+
+Alternatively, the components of the request can be supplied separately via -X, -url,
+-headers (a file containing 'Name: value' lines), -H, and -body. If the signature does
+not match, the verify command tries altering each component of the request in turn
+(e.g. trimming a trailing newline from the body, or dropping the query string), and
+reports any change that would cause the signature to match.
+
+For a definitive answer, sign the same request with -message-out to record the canonical
+message that the signer signed, then pass that file to verify via -signer-message: each
+component of the two messages will be compared.
+*/
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintf(os.Stderr, "Usage: %s sign|verify [flags]\n", os.Args[0])
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "sign":
+		err = runSign(os.Args[2:])
+	case "verify":
+		err = runVerify(os.Args[2:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command '%s' (expected sign|verify)\n", os.Args[1])
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// headerFlags collects repeated -H flags, each of the form 'Name: value'
+type headerFlags []string
+
+func (h *headerFlags) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headerFlags) Set(value string) error {
+	if _, _, ok := strings.Cut(value, ":"); !ok {
+		return fmt.Errorf("header must be of the form 'Name: value'")
+	}
+	*h = append(*h, value)
+	return nil
+}
+
+// splitList splits a comma-separated flag value, ignoring empty elements
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// shellQuote quotes a string for safe inclusion in a POSIX shell command
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/golden-vcr/server-common/hmac"
+)
+
+func runSign(args []string) error {
+	fs := flag.NewFlagSet("sign", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: sign [flags] <url>\n")
+		fs.PrintDefaults()
+	}
+	secret := fs.String("secret", os.Getenv("HMAC_SECRET"), "shared secret used to sign the request")
+	privateKey := fs.String("private-key", "", "base64-encoded Ed25519 private key, used in lieu of -secret")
+	method := fs.String("X", "", "HTTP method (default GET, or POST if a body is supplied)")
+	data := fs.String("d", "", "request body")
+	dataFile := fs.String("data-file", "", "path to a file containing the request body, or - for stdin")
+	var headers headerFlags
+	fs.Var(&headers, "H", "additional request header, as 'Name: value' (may be repeated)")
+	v2 := fs.Bool("v2", false, "produce a SignatureV2 signature, covering the method, path, and query")
+	signedHeaders := fs.String("signed-headers", "", "comma-separated names of headers to cover with a V2 signature")
+	algorithms := fs.String("algorithms", "", "comma-separated signature algorithms (sha256, sha512, ed25519)")
+	keyId := fs.String("key-id", "", "key ID to identify in the x-hmac-key-id header")
+	callerId := fs.String("caller", "", "caller ID to identify in the x-hmac-caller-id header")
+	requestId := fs.String("request-id", "", "request ID to use, in lieu of a new random ID")
+	timestamp := fs.String("timestamp", "", "RFC3339 timestamp to use, in lieu of the current time")
+	messageOut := fs.String("message-out", "", "path to a file to which the canonical signed message will be written, for comparison via 'verify -signer-message'")
+	send := fs.Bool("send", false, "send the request and print the response, rather than printing a curl command")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected a single URL argument")
+	}
+	url := fs.Arg(0)
+
+	// Resolve the request body
+	var body []byte
+	switch {
+	case *dataFile == "-":
+		b, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("failed to read body from stdin: %w", err)
+		}
+		body = b
+	case *dataFile != "":
+		b, err := os.ReadFile(*dataFile)
+		if err != nil {
+			return fmt.Errorf("failed to read body: %w", err)
+		}
+		body = b
+	default:
+		body = []byte(*data)
+	}
+	if *method == "" {
+		*method = http.MethodGet
+		if len(body) > 0 {
+			*method = http.MethodPost
+		}
+	}
+
+	// Build the request
+	req, err := http.NewRequest(strings.ToUpper(*method), url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid request: %w", err)
+	}
+	for _, header := range headers {
+		name, value, _ := strings.Cut(header, ":")
+		req.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	if *requestId != "" {
+		req.Header.Set(hmac.HeaderRequestId, *requestId)
+	}
+	if *timestamp != "" {
+		req.Header.Set(hmac.HeaderRequestTimestamp, *timestamp)
+	}
+
+	// Prepare a signer configured per our flags, and sign the request
+	var opts []hmac.SignerOption
+	if *requestId != "" || *timestamp != "" {
+		// Sign in place so that the signer uses the ID and/or timestamp we've supplied
+		opts = append(opts, hmac.WithInPlaceSigning())
+	}
+	if *v2 || *signedHeaders != "" {
+		opts = append(opts, hmac.WithSignatureV2(splitList(*signedHeaders)...))
+	}
+	if *algorithms != "" {
+		var algs []hmac.Algorithm
+		for _, s := range splitList(*algorithms) {
+			alg, err := hmac.ParseAlgorithm(s)
+			if err != nil {
+				return err
+			}
+			algs = append(algs, alg)
+		}
+		opts = append(opts, hmac.WithAlgorithms(algs...))
+	}
+	if *callerId != "" {
+		opts = append(opts, hmac.WithCallerId(*callerId))
+	}
+	key := hmac.Key{ID: *keyId, Secret: *secret}
+	if *privateKey != "" {
+		b, err := base64.StdEncoding.DecodeString(*privateKey)
+		if err != nil || len(b) != ed25519.PrivateKeySize {
+			return fmt.Errorf("-private-key must be a base64-encoded %d-byte Ed25519 private key", ed25519.PrivateKeySize)
+		}
+		key.PrivateKey = b
+	}
+	if key.Secret == "" && key.PrivateKey == nil {
+		return fmt.Errorf("a secret must be supplied via -secret or HMAC_SECRET")
+	}
+	var signer hmac.Signer
+	switch {
+	case key.ID != "":
+		keyring, err := hmac.NewKeyring(key.ID, key)
+		if err != nil {
+			return err
+		}
+		signer = hmac.NewKeyringSigner(keyring, opts...)
+	case key.PrivateKey != nil && key.Secret != "":
+		return fmt.Errorf("-secret and -private-key may only be combined with -key-id")
+	case key.PrivateKey != nil:
+		signer = hmac.NewEd25519Signer(key.PrivateKey, opts...)
+	default:
+		signer = hmac.NewSigner(key.Secret, opts...)
+	}
+	req, err = signer.Sign(req, body)
+	if err != nil {
+		return fmt.Errorf("failed to sign request: %w", err)
+	}
+
+	if *messageOut != "" {
+		message, err := hmac.CanonicalMessage(req, body)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(*messageOut, message, 0644); err != nil {
+			return fmt.Errorf("failed to write canonical message: %w", err)
+		}
+	}
+
+	if *send {
+		return sendRequest(req, body)
+	}
+	printCurlCommand(os.Stdout, req, body, *dataFile)
+	return nil
+}
+
+// printCurlCommand writes a curl command that will send the given request
+func printCurlCommand(w io.Writer, req *http.Request, body []byte, dataFile string) {
+	fmt.Fprintf(w, "curl -X %s %s", req.Method, shellQuote(req.URL.String()))
+
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range req.Header.Values(name) {
+			fmt.Fprintf(w, " \\\n  -H %s", shellQuote(strings.ToLower(name)+": "+value))
+		}
+	}
+
+	if len(body) > 0 {
+		if dataFile != "" && dataFile != "-" {
+			fmt.Fprintf(w, " \\\n  --data-binary %s", shellQuote("@"+dataFile))
+		} else {
+			fmt.Fprintf(w, " \\\n  --data-binary %s", shellQuote(string(body)))
+		}
+	}
+	fmt.Fprintln(w)
+}
+
+// sendRequest sends the given request and prints the response
+func sendRequest(req *http.Request, body []byte) error {
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer res.Body.Close()
+
+	fmt.Printf("%s %s\n", res.Proto, res.Status)
+	res.Header.Write(os.Stdout)
+	fmt.Println()
+	_, err = io.Copy(os.Stdout, res.Body)
+	return err
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golden-vcr/server-common/hmac"
+)
+
+func runVerify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	secret := fs.String("secret", os.Getenv("HMAC_SECRET"), "shared secret used to verify the request")
+	publicKey := fs.String("public-key", "", "base64-encoded Ed25519 public key, used in lieu of -secret")
+	requestFile := fs.String("request", "", "path to a captured raw HTTP/1.1 request (request line, headers, and body), or - for stdin")
+	method := fs.String("X", http.MethodPost, "HTTP method, if -request is not supplied")
+	url := fs.String("url", "/", "request URL or path, if -request is not supplied")
+	headersFile := fs.String("headers", "", "path to a file containing captured headers, one 'Name: value' per line")
+	var headers headerFlags
+	fs.Var(&headers, "H", "captured request header, as 'Name: value' (may be repeated)")
+	bodyFile := fs.String("body", "", "path to a file containing the captured request body")
+	signerMessage := fs.String("signer-message", "", "path to the canonical message written by 'sign -message-out', to compare component-by-component")
+	maxSkew := fs.Duration("max-skew", 0, "if set, also check that the request timestamp is within this window of the current time")
+	fs.Parse(args)
+
+	// Reconstruct the captured request
+	req, body, err := readCapturedRequest(*requestFile, *method, *url, *headersFile, headers, *bodyFile)
+	if err != nil {
+		return err
+	}
+
+	// Prepare a verifier for the supplied key
+	var newVerifier func() hmac.Verifier
+	switch {
+	case *publicKey != "":
+		b, err := base64.StdEncoding.DecodeString(*publicKey)
+		if err != nil || len(b) != ed25519.PublicKeySize {
+			return fmt.Errorf("-public-key must be a base64-encoded %d-byte Ed25519 public key", ed25519.PublicKeySize)
+		}
+		newVerifier = func() hmac.Verifier { return hmac.NewEd25519Verifier(b) }
+	case *secret != "":
+		newVerifier = func() hmac.Verifier { return hmac.NewVerifier(*secret) }
+	default:
+		return fmt.Errorf("a secret must be supplied via -secret or HMAC_SECRET")
+	}
+
+	var expected []byte
+	if *signerMessage != "" {
+		expected, err = os.ReadFile(*signerMessage)
+		if err != nil {
+			return fmt.Errorf("failed to read signer message: %w", err)
+		}
+	}
+
+	if !explain(os.Stdout, req, body, newVerifier, *maxSkew, expected) {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// readCapturedRequest reconstructs a request from either a raw HTTP/1.1 capture, or
+// from its separately-captured components
+func readCapturedRequest(requestFile, method, url, headersFile string, headers []string, bodyFile string) (*http.Request, []byte, error) {
+	if requestFile != "" {
+		var r io.Reader = os.Stdin
+		if requestFile != "-" {
+			f, err := os.Open(requestFile)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to open captured request: %w", err)
+			}
+			defer f.Close()
+			r = f
+		}
+		req, err := http.ReadRequest(bufio.NewReader(r))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse captured request: %w", err)
+		}
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read captured request body: %w", err)
+		}
+		return req, body, nil
+	}
+
+	req, err := http.NewRequest(strings.ToUpper(method), url, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid request: %w", err)
+	}
+	if headersFile != "" {
+		data, err := os.ReadFile(headersFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read headers: %w", err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if name, value, ok := strings.Cut(line, ":"); ok {
+				headers = append(headers, name+":"+value)
+			}
+		}
+	}
+	for _, header := range headers {
+		name, value, _ := strings.Cut(header, ":")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if strings.EqualFold(name, "host") {
+			req.Host = value
+			continue
+		}
+		req.Header.Add(name, value)
+	}
+	var body []byte
+	if bodyFile != "" {
+		body, err = os.ReadFile(bodyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read body: %w", err)
+		}
+	}
+	return req, body, nil
+}
+
+// explain verifies the given request, writing a report of each component of the
+// request to w. If verification fails, it attempts to identify which component differs
+// from what the signer saw. Returns true if the request was verified.
+func explain(w io.Writer, req *http.Request, body []byte, newVerifier func() hmac.Verifier, maxSkew time.Duration, signerMessage []byte) bool {
+	bodyDigest := sha256.Sum256(body)
+	fmt.Fprintf(w, "Method:          %s\n", req.Method)
+	fmt.Fprintf(w, "URL:             %s\n", req.URL.RequestURI())
+	fmt.Fprintf(w, "Request ID:      %s\n", describeHeader(req, hmac.HeaderRequestId))
+	fmt.Fprintf(w, "Timestamp:       %s\n", describeTimestamp(req, maxSkew))
+	fmt.Fprintf(w, "Key ID:          %s\n", describeHeader(req, hmac.HeaderKeyId))
+	fmt.Fprintf(w, "Caller ID:       %s\n", describeHeader(req, hmac.HeaderCallerId))
+	fmt.Fprintf(w, "Signature:       %s\n", describeHeader(req, hmac.HeaderSignature))
+	fmt.Fprintf(w, "Signed headers:  %s\n", describeHeader(req, hmac.HeaderSignedHeaders))
+	fmt.Fprintf(w, "Body:            %d bytes, sha256 %s\n", len(body), hex.EncodeToString(bodyDigest[:]))
+	message, err := hmac.CanonicalMessage(req, body)
+	if err == nil {
+		fmt.Fprintf(w, "\nCanonical message (as seen by the verifier):\n")
+		for _, line := range strings.Split(string(message), "\n") {
+			fmt.Fprintf(w, "  %q\n", line)
+		}
+	}
+
+	// Check the signature itself: this is the same check a real verifier performs,
+	// minus the timestamp window and replay protection
+	err = newVerifier().Verify(req, body)
+	if err == nil {
+		fmt.Fprintf(w, "\nResult: signature is VALID\n")
+		return true
+	}
+	fmt.Fprintf(w, "\nResult: signature is INVALID (%v)\n", err)
+	if req.Header.Get(hmac.HeaderRequestId) == "" || req.Header.Get(hmac.HeaderRequestTimestamp) == "" || req.Header.Get(hmac.HeaderSignature) == "" {
+		fmt.Fprintf(w, "The request is missing one or more required headers.\n")
+		return false
+	}
+
+	// If we know what the signer signed, we can simply compare the two messages
+	if signerMessage != nil && message != nil {
+		mismatches := compareMessages(req, signerMessage, message)
+		if len(mismatches) == 0 {
+			fmt.Fprintf(w, "The signer signed the same message: it must have used a different secret (or key).\n")
+			return false
+		}
+		fmt.Fprintf(w, "The following components differ between the signer and the verifier:\n")
+		for _, mismatch := range mismatches {
+			fmt.Fprintf(w, "  - %s\n", mismatch)
+		}
+		return false
+	}
+
+	// Try altering each component of the request in turn, to see if any single change
+	// would produce a matching signature
+	var matches []string
+	for _, variant := range requestVariants(req, body) {
+		variantReq, variantBody := variant.apply(req, body)
+		if newVerifier().Verify(variantReq, variantBody) == nil {
+			matches = append(matches, variant.description)
+		}
+	}
+	if len(matches) == 0 {
+		fmt.Fprintf(w, "No single change to the request produces a matching signature: most likely, the\n")
+		fmt.Fprintf(w, "signer used a different secret (or key), or several components were modified.\n")
+		return false
+	}
+	fmt.Fprintf(w, "The signature would match if:\n")
+	for _, description := range matches {
+		fmt.Fprintf(w, "  - %s\n", description)
+	}
+	return false
+}
+
+// compareMessages compares the canonical message computed by the signer with the one
+// computed by the verifier, describing each component that differs
+func compareMessages(req *http.Request, signerMessage, verifierMessage []byte) []string {
+	describe := func(component string, signer, verifier string) string {
+		return fmt.Sprintf("%s: the signer saw %q, but the verifier saw %q", component, signer, verifier)
+	}
+
+	// SignatureV2 messages have one component per line
+	if bytes.HasPrefix(verifierMessage, []byte("HMAC-V2\n")) {
+		signerLines := strings.Split(string(signerMessage), "\n")
+		verifierLines := strings.Split(string(verifierMessage), "\n")
+		labels := []string{"signature version", "method", "path", "query", "request ID", "timestamp", "signed header names"}
+		for _, name := range strings.Split(req.Header.Get(hmac.HeaderSignedHeaders), ";") {
+			if name != "" {
+				labels = append(labels, fmt.Sprintf("'%s' header", name))
+			}
+		}
+		labels = append(labels, "body (SHA-256 digest)")
+
+		var mismatches []string
+		for i := 0; i < max(len(signerLines), len(verifierLines)); i++ {
+			var signerLine, verifierLine string
+			if i < len(signerLines) {
+				signerLine = signerLines[i]
+			}
+			if i < len(verifierLines) {
+				verifierLine = verifierLines[i]
+			}
+			if signerLine == verifierLine {
+				continue
+			}
+			label := fmt.Sprintf("line %d", i+1)
+			if i < len(labels) && len(signerLines) == len(verifierLines) {
+				label = labels[i]
+			}
+			mismatches = append(mismatches, describe(label, signerLine, verifierLine))
+		}
+		return mismatches
+	}
+
+	// SignatureV1 messages are the concatenation of request ID, timestamp, and body
+	prefix := req.Header.Get(hmac.HeaderRequestId) + req.Header.Get(hmac.HeaderRequestTimestamp)
+	if !bytes.HasPrefix(signerMessage, []byte(prefix)) {
+		n := min(len(prefix), len(signerMessage))
+		return []string{describe("request ID and timestamp", string(signerMessage[:n]), prefix)}
+	}
+	signerBody := signerMessage[len(prefix):]
+	verifierBody := verifierMessage[len(prefix):]
+	if bytes.Equal(signerBody, verifierBody) {
+		return nil
+	}
+	return []string{describe("body", string(signerBody), string(verifierBody))}
+}
+
+// describeHeader returns the value of the named header, or a placeholder if it's unset
+func describeHeader(req *http.Request, name string) string {
+	if value := req.Header.Get(name); value != "" {
+		return value
+	}
+	return "(not set)"
+}
+
+// describeTimestamp describes the request timestamp, noting how far it is from the
+// current time
+func describeTimestamp(req *http.Request, maxSkew time.Duration) string {
+	value := req.Header.Get(hmac.HeaderRequestTimestamp)
+	if value == "" {
+		return "(not set)"
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return value + " (MALFORMED: not an RFC3339 timestamp)"
+	}
+	age := time.Since(t).Round(time.Second)
+	description := fmt.Sprintf("%s (%s ago)", value, age)
+	if maxSkew > 0 && (age > maxSkew || age < -maxSkew) {
+		description += fmt.Sprintf(" (OUTSIDE the %s window)", maxSkew)
+	}
+	return description
+}
+
+// requestVariant describes a single alteration to a request
+type requestVariant struct {
+	description string
+	apply       func(req *http.Request, body []byte) (*http.Request, []byte)
+}
+
+// requestVariants returns alterations to each component of a request that commonly
+// explain signature mismatches (e.g. a proxy that adds a trailing newline to the body
+// or rewrites the path)
+func requestVariants(req *http.Request, body []byte) []requestVariant {
+	withBody := func(description string, newBody []byte) requestVariant {
+		return requestVariant{description, func(r *http.Request, _ []byte) (*http.Request, []byte) {
+			return r, newBody
+		}}
+	}
+	withRequest := func(description string, modify func(r *http.Request)) requestVariant {
+		return requestVariant{description, func(r *http.Request, b []byte) (*http.Request, []byte) {
+			clone := r.Clone(r.Context())
+			modify(clone)
+			return clone, b
+		}}
+	}
+
+	var variants []requestVariant
+	if trimmed := bytes.TrimRight(body, "\r\n"); len(trimmed) != len(body) {
+		variants = append(variants, withBody("the body did not have a trailing newline (the signer saw it without one)", trimmed))
+	} else {
+		variants = append(variants, withBody("the body had a trailing newline", append(append([]byte(nil), body...), '\n')))
+	}
+	if bytes.Contains(body, []byte("\r\n")) {
+		variants = append(variants, withBody("the body used LF line endings rather than CRLF", bytes.ReplaceAll(body, []byte("\r\n"), []byte("\n"))))
+	} else if bytes.Contains(body, []byte("\n")) {
+		variants = append(variants, withBody("the body used CRLF line endings rather than LF", bytes.ReplaceAll(body, []byte("\n"), []byte("\r\n"))))
+	}
+	if len(body) > 0 {
+		variants = append(variants, withBody("the body was empty", nil))
+	}
+
+	// The remaining components are only covered by V2 signatures
+	if !strings.Contains(req.Header.Get(hmac.HeaderSignature), "v2-") {
+		return variants
+	}
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		if method != req.Method {
+			variants = append(variants, withRequest("the method was "+method, func(r *http.Request) { r.Method = method }))
+		}
+	}
+	if req.URL.RawQuery != "" {
+		variants = append(variants, withRequest("the URL had no query string", func(r *http.Request) { r.URL.RawQuery = "" }))
+	}
+	if path := req.URL.Path; strings.HasSuffix(path, "/") && path != "/" {
+		variants = append(variants, withRequest("the path had no trailing slash", func(r *http.Request) {
+			r.URL.Path, r.URL.RawPath = strings.TrimSuffix(path, "/"), ""
+		}))
+	} else {
+		variants = append(variants, withRequest("the path had a trailing slash", func(r *http.Request) {
+			r.URL.Path, r.URL.RawPath = path+"/", ""
+		}))
+	}
+	for _, prefix := range pathPrefixes(req.URL.Path) {
+		variants = append(variants, withRequest(fmt.Sprintf("the path did not include the prefix '%s' (e.g. it was stripped by a proxy)", prefix), func(r *http.Request) {
+			r.URL.Path, r.URL.RawPath = strings.TrimPrefix(req.URL.Path, prefix), ""
+		}))
+	}
+	for _, name := range strings.Split(req.Header.Get(hmac.HeaderSignedHeaders), ";") {
+		if name == "" || name == "host" {
+			continue
+		}
+		variants = append(variants, withRequest(fmt.Sprintf("the '%s' header was not set", name), func(r *http.Request) { r.Header.Del(name) }))
+	}
+	if host, _, ok := strings.Cut(req.Host, ":"); ok {
+		variants = append(variants, withRequest("the host was '"+host+"' (without a port)", func(r *http.Request) { r.Host = host }))
+	}
+	return variants
+}
+
+// pathPrefixes returns each leading portion of a path that a reverse proxy might have
+// added, e.g. '/api' and '/api/v1' for '/api/v1/foo'
+func pathPrefixes(path string) []string {
+	var prefixes []string
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i := 1; i < len(segments); i++ {
+		prefixes = append(prefixes, "/"+strings.Join(segments[:i], "/"))
+	}
+	return prefixes
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golden-vcr/server-common/hmac"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_explain(t *testing.T) {
+	// Sign a known-good request, recording the canonical message that the signer saw
+	signer := hmac.NewSigner("my-secret", hmac.WithSignatureV2("content-type"))
+	body := []byte("hello")
+	req := httptest.NewRequest(http.MethodPost, "http://example.com/widgets", nil)
+	req.Header.Set("content-type", "text/plain")
+	signed, err := signer.Sign(req, body)
+	assert.NoError(t, err)
+	signerMessage, err := hmac.CanonicalMessage(signed, body)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name              string
+		secret            string
+		mutate            func(r *http.Request, body []byte) []byte
+		withSignerMessage bool
+		wantValid         bool
+		wantExplanation   string
+	}{
+		{
+			name:            "known-good request is valid",
+			wantValid:       true,
+			wantExplanation: "Result: signature is VALID",
+		},
+		{
+			name: "path with a prefix added by a proxy",
+			mutate: func(r *http.Request, body []byte) []byte {
+				r.URL.Path = "/api/widgets"
+				return body
+			},
+			wantExplanation: "the path did not include the prefix '/api' (e.g. it was stripped by a proxy)",
+		},
+		{
+			name: "query string added after signing",
+			mutate: func(r *http.Request, body []byte) []byte {
+				r.URL.RawQuery = "page=2"
+				return body
+			},
+			wantExplanation: "the URL had no query string",
+		},
+		{
+			name: "body with a trailing newline added after signing",
+			mutate: func(r *http.Request, body []byte) []byte {
+				return append(append([]byte(nil), body...), '\n')
+			},
+			wantExplanation: "the body did not have a trailing newline (the signer saw it without one)",
+		},
+		{
+			name: "timestamp altered after signing",
+			mutate: func(r *http.Request, body []byte) []byte {
+				r.Header.Set(hmac.HeaderRequestTimestamp, "2024-01-01T00:00:00Z")
+				return body
+			},
+			wantExplanation: "No single change to the request produces a matching signature",
+		},
+		{
+			name: "timestamp altered after signing, compared with the signer's message",
+			mutate: func(r *http.Request, body []byte) []byte {
+				r.Header.Set(hmac.HeaderRequestTimestamp, "2024-01-01T00:00:00Z")
+				return body
+			},
+			withSignerMessage: true,
+			wantExplanation:   `timestamp: the signer saw "` + signed.Header.Get(hmac.HeaderRequestTimestamp) + `", but the verifier saw "2024-01-01T00:00:00Z"`,
+		},
+		{
+			name:            "wrong secret",
+			secret:          "wrong-secret",
+			wantExplanation: "No single change to the request produces a matching signature",
+		},
+		{
+			name:              "wrong secret, compared with the signer's message",
+			secret:            "wrong-secret",
+			withSignerMessage: true,
+			wantExplanation:   "The signer signed the same message: it must have used a different secret (or key).",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := signed.Clone(signed.Context())
+			b := body
+			if tt.mutate != nil {
+				b = tt.mutate(r, b)
+			}
+			secret := tt.secret
+			if secret == "" {
+				secret = "my-secret"
+			}
+			var expected []byte
+			if tt.withSignerMessage {
+				expected = signerMessage
+			}
+
+			var out bytes.Buffer
+			newVerifier := func() hmac.Verifier { return hmac.NewVerifier(secret) }
+			valid := explain(&out, r, b, newVerifier, 0, expected)
+			assert.Equal(t, tt.wantValid, valid)
+			assert.Contains(t, out.String(), tt.wantExplanation)
+		})
+	}
+}
+
+func Test_describeTimestamp(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	assert.Equal(t, "(not set)", describeTimestamp(req, 0))
+
+	req.Header.Set(hmac.HeaderRequestTimestamp, "yesterday")
+	assert.Contains(t, describeTimestamp(req, 0), "MALFORMED")
+
+	req.Header.Set(hmac.HeaderRequestTimestamp, time.Now().Add(-time.Hour).Format(time.RFC3339))
+	assert.NotContains(t, describeTimestamp(req, 0), "OUTSIDE")
+	assert.Contains(t, describeTimestamp(req, 5*time.Minute), "OUTSIDE the 5m0s window")
+}
+
+func Test_pathPrefixes(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"/", nil},
+		{"/widgets", nil},
+		{"/api/widgets", []string{"/api"}},
+		{"/api/v1/widgets/", []string{"/api", "/api/v1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.want, pathPrefixes(tt.path))
+		})
+	}
+}
@@ -5,4 +5,64 @@
 // service, it uses the same secret value to verify the request's signature, thereby
 // proving that the request originated from an internal service with access to the
 // shared secret (while refraining from sending the secret itself over the wire).
+//
+// Rather than calling Sign and Verify directly, clients can use an http.Client whose
+// Transport is created via NewTransport, and servers can wrap their handlers with
+// Middleware: both take care of buffering request bodies as needed. gRPC services can
+// use GRPCClientSigning and GRPCServerVerification, which sign the method name and the
+// serialized request message.
+//
+// Large request bodies can be signed and verified without holding them in memory: a
+// request signed via StreamSigner.SignStream (which every Signer created by this
+// package implements) carries its signature in an HTTP trailer, and servers can wrap
+// such requests with StreamingMiddleware, which replaces the request body with a
+// VerifiedBody. A VerifiedBody only returns io.EOF once the signature has been
+// verified, so handlers must read it to completion before committing any side effects.
+//
+// By default, signatures cover only the request ID, timestamp, and body (SignatureV1).
+// Signers configured via WithSignatureV2 additionally sign the request's method, path,
+// query, and a chosen set of headers, so that a signed body can't be replayed against a
+// different endpoint. Verifiers accept both versions unless configured otherwise via
+// WithMinimumSignatureVersion, so that signers can be migrated one at a time. Messages
+// signed in every other format begin with 'HMAC-', so a SignatureV1 message that begins
+// with it is never signed or accepted.
+//
+// To prevent captured requests from being replayed, a Verifier can be configured to
+// reject requests whose timestamps are too old (via WithMaxClockSkew), and to reject
+// requests whose IDs have already been used (via WithNonceStore).
+//
+// To allow secrets to be rotated without downtime, signers and verifiers can be backed
+// by a Keyring (via NewKeyringSigner and NewKeyringVerifier): signers identify the key
+// they used in the x-hmac-key-id header, and verifiers accept any unexpired key in
+// their keyring. To rotate, add the new key to every verifier's keyring, switch signers
+// over to it, then expire the old key once no signer is using it.
+//
+// Signatures are computed with HMAC-SHA256 by default. Signers can instead (or
+// additionally) use HMAC-SHA512 or Ed25519 via WithAlgorithms, and verifiers can
+// restrict which algorithms they accept via WithAcceptedAlgorithms. Ed25519 signatures
+// (see NewEd25519Signer and NewEd25519Verifier) allow a verifier to authenticate
+// requests using only a public key.
+//
+// The headers that carry each request's ID, timestamp, and signature (and the order in
+// which they're concatenated for signing) can be configured via a Scheme. This allows
+// third-party webhooks that use a similar scheme to be verified: in particular,
+// NewEventSubVerifier and EventSubMiddleware handle Twitch EventSub webhook messages.
+//
+// To distinguish between internal callers, each service can be issued its own secret:
+// signers identify themselves via WithCallerId, and a verifier created with
+// NewCallerVerifier authenticates each request as the Principal for that caller, which
+// lists the scopes it's been granted. RequireScopes (or GRPCRequireScopes) restricts
+// individual routes to callers with the necessary scopes.
+//
+// Clients that can't sign their own requests (such as browsers) can be handed a signed
+// URL, created via SignURL (or SignURLWithKeyring), which carries its expiry and
+// signature in query parameters. Servers wrap the handlers for such URLs with
+// URLMiddleware, which rejects any URL that's been tampered with or has expired. URLs
+// are signed with a key derived from the secret, so that a signature taken from a
+// signed URL isn't valid for any request.
+//
+// Every verification failure wraps ErrVerificationFailed, which is reported to clients
+// as a generic 401. The more specific reason (e.g. ErrMissingHeader, ErrUnknownKey, or
+// ErrSignatureMismatch) is only written to the server's logs, so that it can be used to
+// diagnose misconfigured signers without giving anything away to attackers.
 package hmac
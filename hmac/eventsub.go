@@ -0,0 +1,127 @@
+package hmac
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/golden-vcr/server-common/entry"
+)
+
+const (
+	// HeaderEventSubMessageId is the name of the header that carries the unique ID of a
+	// Twitch EventSub webhook message
+	HeaderEventSubMessageId = "twitch-eventsub-message-id"
+
+	// HeaderEventSubMessageTimestamp is the name of the header that carries the time at
+	// which Twitch sent an EventSub webhook message
+	HeaderEventSubMessageTimestamp = "twitch-eventsub-message-timestamp"
+
+	// HeaderEventSubMessageSignature is the name of the header that carries the
+	// HMAC-SHA256 signature of an EventSub webhook message
+	HeaderEventSubMessageSignature = "twitch-eventsub-message-signature"
+
+	// HeaderEventSubMessageType is the name of the header that identifies the type of an
+	// EventSub webhook message: 'notification', 'webhook_callback_verification', or
+	// 'revocation'
+	HeaderEventSubMessageType = "twitch-eventsub-message-type"
+)
+
+// EventSubMaxMessageAge is the maximum age of an EventSub message that will be accepted
+// by a verifier created with NewEventSubVerifier, per Twitch's recommendation
+const EventSubMaxMessageAge = 10 * time.Minute
+
+// EventSubScheme describes the signatures that Twitch attaches to EventSub webhook
+// messages: an HMAC-SHA256 over the message ID, timestamp, and body, keyed with the
+// secret supplied when the subscription was created
+var EventSubScheme = Scheme{
+	RequestIdHeader:   HeaderEventSubMessageId,
+	TimestampHeader:   HeaderEventSubMessageTimestamp,
+	SignatureHeader:   HeaderEventSubMessageSignature,
+	MessageComponents: []MessageComponent{ComponentRequestId, ComponentTimestamp, ComponentBody},
+}
+
+// NewEventSubVerifier initializes a Verifier that verifies Twitch EventSub webhook
+// messages signed with the given subscription secret. Messages older than
+// EventSubMaxMessageAge are rejected, as are messages whose IDs have already been seen
+// (which are tracked in memory unless a different store is supplied via
+// WithNonceStore).
+func NewEventSubVerifier(secret string, opts ...VerifierOption) Verifier {
+	defaults := []VerifierOption{
+		WithVerificationScheme(EventSubScheme),
+		WithAcceptedAlgorithms(AlgorithmHMACSHA256),
+		WithMaxClockSkew(EventSubMaxMessageAge),
+		WithNonceStore(NewMemoryNonceStore()),
+	}
+	return NewVerifier(secret, append(defaults, opts...)...)
+}
+
+// EventSubMiddleware returns HTTP middleware that handles incoming Twitch EventSub
+// webhook messages, verifying each message with the given Verifier (which should be
+// created via NewEventSubVerifier):
+//
+//   - Messages that fail verification are rejected with a 401 error
+//   - Duplicate deliveries of an already-verified message are acknowledged with a 204
+//     response, without being passed to the next handler, so that Twitch will stop
+//     retrying them
+//   - webhook_callback_verification messages are answered with the challenge value
+//     from the request body, as required to confirm a new subscription
+//
+// All other messages are passed to the next handler with their body intact. As with
+// Middleware, request bodies are limited to DefaultMaxBodyBytes unless configured
+// otherwise via WithMaxBodyBytes.
+func EventSubMiddleware(v Verifier, opts ...MiddlewareOption) func(http.Handler) http.Handler {
+	config := newMiddlewareConfig(opts)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, ok := readBody(w, r, config.maxBodyBytes)
+			if !ok {
+				return
+			}
+
+			messageId := r.Header.Get(HeaderEventSubMessageId)
+			messageType := r.Header.Get(HeaderEventSubMessageType)
+			principal, err := authenticate(v, r, body)
+			if errors.Is(err, ErrReplayedRequest) {
+				entry.Log(r).Info("Ignoring duplicate EventSub message", "eventSubMessageId", messageId, "eventSubMessageType", messageType)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			if err != nil {
+				entry.Log(r).Warn("Rejecting EventSub message with invalid signature", "eventSubMessageId", messageId, "error", err)
+				entry.WriteError(w, r, err)
+				return
+			}
+
+			// Respond to the challenge that Twitch sends when a subscription is created
+			if messageType == "webhook_callback_verification" {
+				var payload struct {
+					Challenge string `json:"challenge"`
+				}
+				if err := json.Unmarshal(body, &payload); err != nil || payload.Challenge == "" {
+					entry.WriteError(w, r, &entry.Error{
+						Status:  http.StatusBadRequest,
+						Code:    "invalid_challenge",
+						Message: "webhook callback verification request has no challenge",
+						Err:     err,
+					})
+					return
+				}
+				entry.Log(r).Info("Responding to EventSub webhook callback verification", "eventSubMessageId", messageId)
+				w.Header().Set("content-type", "text/plain")
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(payload.Challenge))
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), "hmac-principal", principal)
+			r = r.WithContext(ctx)
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
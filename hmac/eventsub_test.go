@@ -0,0 +1,100 @@
+package hmac
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Scheme(t *testing.T) {
+	t.Run("message components are concatenated in order", func(t *testing.T) {
+		scheme := Scheme{MessageComponents: []MessageComponent{ComponentBody, ComponentRequestId}}
+		assert.Equal(t, "hello world1234", string(scheme.messageV1("1234", "2023-12-06T21:06:04Z", []byte("hello world"))))
+	})
+	t.Run("signer and verifier use the configured headers", func(t *testing.T) {
+		scheme := Scheme{
+			RequestIdHeader:   "x-custom-id",
+			TimestampHeader:   "x-custom-time",
+			SignatureHeader:   "x-custom-signature",
+			MessageComponents: []MessageComponent{ComponentTimestamp, ComponentRequestId, ComponentBody},
+		}
+		body := []byte("hello world")
+		req, err := http.NewRequest(http.MethodPost, "/somewhere", bytes.NewReader(body))
+		assert.NoError(t, err)
+		req, err = NewSigner("my-secret", WithSigningScheme(scheme)).Sign(req, body)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, req.Header.Get("x-custom-signature"))
+		assert.Empty(t, req.Header.Get(HeaderSignature))
+
+		assert.NoError(t, NewVerifier("my-secret", WithVerificationScheme(scheme)).Verify(req, body))
+		assert.ErrorIs(t, NewVerifier("my-secret").Verify(req, body), ErrVerificationFailed)
+	})
+}
+
+func Test_EventSubMiddleware(t *testing.T) {
+	secret := "s3cr3t-s3cr3t"
+	var handled []byte
+	h := EventSubMiddleware(NewEventSubVerifier(secret))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handled, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	// Build requests the same way Twitch does, independently of our Signer
+	newRequest := func(messageId, messageType string, timestamp time.Time, body string) *http.Request {
+		ts := timestamp.UTC().Format(time.RFC3339Nano)
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(messageId + ts + body))
+
+		req := httptest.NewRequest(http.MethodPost, "/eventsub", bytes.NewReader([]byte(body)))
+		req.Header.Set("Twitch-Eventsub-Message-Id", messageId)
+		req.Header.Set("Twitch-Eventsub-Message-Timestamp", ts)
+		req.Header.Set("Twitch-Eventsub-Message-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+		req.Header.Set("Twitch-Eventsub-Message-Type", messageType)
+		return req
+	}
+
+	t.Run("notification is passed to handler", func(t *testing.T) {
+		handled = nil
+		body := `{"subscription":{"type":"channel.follow"},"event":{}}`
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, newRequest("msg-1", "notification", time.Now(), body))
+		assert.Equal(t, http.StatusNoContent, res.Code)
+		assert.Equal(t, body, string(handled))
+	})
+	t.Run("duplicate notification is acknowledged but not handled", func(t *testing.T) {
+		handled = nil
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, newRequest("msg-1", "notification", time.Now(), `{}`))
+		assert.Equal(t, http.StatusNoContent, res.Code)
+		assert.Nil(t, handled)
+	})
+	t.Run("challenge is answered", func(t *testing.T) {
+		handled = nil
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, newRequest("msg-2", "webhook_callback_verification", time.Now(), `{"challenge":"pogchamp-kappa-360noscope-vohiyo"}`))
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, "pogchamp-kappa-360noscope-vohiyo", res.Body.String())
+		assert.Nil(t, handled)
+	})
+	t.Run("stale message is rejected", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, newRequest("msg-3", "notification", time.Now().Add(-11*time.Minute), `{}`))
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+	})
+	t.Run("tampered message is rejected", func(t *testing.T) {
+		req := newRequest("msg-4", "notification", time.Now(), `{}`)
+		req.Body = io.NopCloser(bytes.NewReader([]byte(`{"event":{}}`)))
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+		assert.Nil(t, handled)
+	})
+}
@@ -0,0 +1,100 @@
+package hmac
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net"
+	"testing"
+
+	"github.com/golden-vcr/server-common/entry"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type principalHealthServer struct {
+	*health.Server
+	principal *Principal
+}
+
+func (s *principalHealthServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	s.principal, _ = PrincipalFromContext(ctx)
+	return s.Server.Check(ctx, req)
+}
+
+func Test_GRPC(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, nil))
+
+	keyring, err := NewKeyring("k1", Key{ID: "k1", Secret: "my-secret"})
+	assert.NoError(t, err)
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		entry.GRPCServerLogging(logger),
+		GRPCServerVerification(NewKeyringVerifier(keyring)),
+	))
+	healthSrv := &principalHealthServer{Server: health.NewServer()}
+	healthpb.RegisterHealthServer(srv, healthSrv)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	dial := func(t *testing.T, opts ...grpc.DialOption) healthpb.HealthClient {
+		opts = append(opts,
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+				return lis.DialContext(ctx)
+			}),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		)
+		conn, err := grpc.NewClient("passthrough:///bufnet", opts...)
+		assert.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		return healthpb.NewHealthClient(conn)
+	}
+
+	t.Run("signed call is verified", func(t *testing.T) {
+		client := dial(t, grpc.WithUnaryInterceptor(GRPCClientSigning(NewKeyringSigner(keyring))))
+		res, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+		assert.NoError(t, err)
+		assert.Equal(t, healthpb.HealthCheckResponse_SERVING, res.Status)
+		assert.Equal(t, &Principal{KeyId: "k1", Algorithm: AlgorithmHMACSHA256}, healthSrv.principal)
+	})
+	t.Run("unsigned call is rejected", func(t *testing.T) {
+		healthSrv.principal = nil
+		client := dial(t)
+		_, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+		assert.Nil(t, healthSrv.principal)
+		assert.Contains(t, logs.String(), `"msg":"Rejecting request with invalid HMAC signature"`)
+	})
+	t.Run("call signed with the wrong secret is rejected", func(t *testing.T) {
+		client := dial(t, grpc.WithUnaryInterceptor(GRPCClientSigning(NewSigner("wrong-secret"))))
+		_, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+	t.Run("signature is bound to the request message", func(t *testing.T) {
+		// Sign a request for one service, but send a request for another
+		tamper := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			return invoker(ctx, method, &healthpb.HealthCheckRequest{Service: "other"}, reply, cc, opts...)
+		}
+		client := dial(t, grpc.WithChainUnaryInterceptor(GRPCClientSigning(NewKeyringSigner(keyring)), tamper))
+		_, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+	t.Run("signer that can't sign gRPC requests fails the call", func(t *testing.T) {
+		client := dial(t, grpc.WithUnaryInterceptor(GRPCClientSigning(httpOnlySigner{NewKeyringSigner(keyring)})))
+		_, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+		assert.ErrorContains(t, err, "does not support signing gRPC requests")
+	})
+}
+
+// httpOnlySigner is a Signer that exposes none of the optional signing capabilities
+type httpOnlySigner struct {
+	Signer
+}
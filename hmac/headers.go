@@ -9,8 +9,22 @@ const (
 	// timestamp indicating when the request was made
 	HeaderRequestTimestamp = "x-hmac-request-timestamp"
 
-	// HeaderSignature is the name of the header that carries the HMAC signature
-	// computed from the concatenation of the request ID, timestamp string, and request
-	// payload body
+	// HeaderSignature is the name of the header that carries the signature computed
+	// from the concatenation of the request ID, timestamp string, and request payload
+	// body (for SignatureV1), or from the canonical request (for SignatureV2). It may
+	// carry several comma-separated signatures, computed with different algorithms.
 	HeaderSignature = "x-hmac-signature"
+
+	// HeaderSignedHeaders is the name of the header that lists, separated by
+	// semicolons, the names of any additional headers covered by a SignatureV2
+	// signature
+	HeaderSignedHeaders = "x-hmac-signed-headers"
+
+	// HeaderKeyId is the name of the header that identifies which key in a Keyring was
+	// used to compute the signature
+	HeaderKeyId = "x-hmac-key-id"
+
+	// HeaderCallerId is the name of the header that identifies the internal service that
+	// signed the request, and thereby which caller's secret was used to sign it
+	HeaderCallerId = "x-hmac-caller-id"
 )
@@ -0,0 +1,249 @@
+package hmac
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Key is a shared secret (or Ed25519 key pair) used to sign and verify requests,
+// identified by a key ID that signers send in HeaderKeyId
+type Key struct {
+	ID     string `json:"id"`
+	Secret string `json:"secret,omitempty"`
+
+	// PrivateKey is used to compute AlgorithmEd25519 signatures; it's only needed by
+	// signers
+	PrivateKey ed25519.PrivateKey `json:"privateKey,omitempty"`
+
+	// PublicKey is used to verify AlgorithmEd25519 signatures; it may be omitted if
+	// PrivateKey is set
+	PublicKey ed25519.PublicKey `json:"publicKey,omitempty"`
+
+	// ExpiresAt, if set, is the time after which verifiers will no longer accept
+	// signatures made with this key: when a key is rotated out, it should be given an
+	// expiry far enough in the future to allow all signers to pick up the new key
+	ExpiresAt time.Time `json:"expiresAt,omitempty"`
+}
+
+// keyringDocument is the JSON representation of a Keyring, as read by LoadKeyringFile
+// and LoadKeyringFromEnv
+type keyringDocument struct {
+	Current string `json:"current"`
+	Keys    []Key  `json:"keys"`
+}
+
+// Keyring holds a set of keys, one of which is designated as the current key: signers
+// sign with the current key, and verifiers accept signatures made with any unexpired key
+// in the keyring. This allows secrets to be rotated without a synchronized deploy:
+//
+//  1. Add a new key to every verifier's keyring
+//  2. Make the new key current in every signer's keyring, and set an expiry on the old
+//     key
+//  3. Once the old key has expired, remove it
+//
+// A Keyring is safe for concurrent use, and its contents may be replaced at any time.
+type Keyring struct {
+	now func() time.Time
+
+	mu      sync.RWMutex
+	current string
+	keys    map[string]Key
+}
+
+// NewKeyring initializes a Keyring containing the given keys, with the key whose ID is
+// current being used for signing
+func NewKeyring(current string, keys ...Key) (*Keyring, error) {
+	k := &Keyring{now: time.Now}
+	if err := k.Replace(current, keys...); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// LoadKeyringFile initializes a Keyring from a JSON file of the form:
+//
+//	{
+//	  "current": "2024-06",
+//	  "keys": [
+//	    {"id": "2024-06", "secret": "..."},
+//	    {"id": "2024-01", "secret": "...", "expiresAt": "2024-07-01T00:00:00Z"}
+//	  ]
+//	}
+//
+// Ed25519 keys may be given as base64-encoded "privateKey" and/or "publicKey" values,
+// in lieu of or in addition to "secret".
+func LoadKeyringFile(path string) (*Keyring, error) {
+	k := &Keyring{now: time.Now}
+	if err := k.reloadFile(path); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// LoadKeyringFromEnv initializes a Keyring from the value of the named environment
+// variable, which must contain a JSON document in the format used by LoadKeyringFile
+func LoadKeyringFromEnv(name string) (*Keyring, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil, fmt.Errorf("environment variable %s is not set", name)
+	}
+	doc, err := parseKeyringDocument([]byte(value))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse keyring from %s: %w", name, err)
+	}
+	return NewKeyring(doc.Current, doc.Keys...)
+}
+
+// Replace atomically replaces the contents of the keyring
+func (k *Keyring) Replace(current string, keys ...Key) error {
+	byId := make(map[string]Key, len(keys))
+	for _, key := range keys {
+		if key.ID == "" {
+			return fmt.Errorf("keyring contains a key with no ID")
+		}
+		if key.Secret == "" && len(key.PrivateKey) == 0 && len(key.PublicKey) == 0 {
+			return fmt.Errorf("key '%s' has no secret", key.ID)
+		}
+		if len(key.PrivateKey) != 0 && len(key.PrivateKey) != ed25519.PrivateKeySize {
+			return fmt.Errorf("key '%s' has an invalid Ed25519 private key", key.ID)
+		}
+		if len(key.PublicKey) != 0 && len(key.PublicKey) != ed25519.PublicKeySize {
+			return fmt.Errorf("key '%s' has an invalid Ed25519 public key", key.ID)
+		}
+		if _, ok := byId[key.ID]; ok {
+			return fmt.Errorf("keyring contains duplicate key ID '%s'", key.ID)
+		}
+		byId[key.ID] = key
+	}
+	if _, ok := byId[current]; !ok {
+		return fmt.Errorf("current key '%s' is not in keyring", current)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.current = current
+	k.keys = byId
+	return nil
+}
+
+// Current returns the key that should be used for signing
+func (k *Keyring) Current() Key {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return k.keys[k.current]
+}
+
+// Lookup returns the key with the given ID, if it exists and has not expired
+func (k *Keyring) Lookup(id string) (Key, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	key, ok := k.keys[id]
+	if !ok || (!key.ExpiresAt.IsZero() && !k.now().Before(key.ExpiresAt)) {
+		return Key{}, false
+	}
+	return key, true
+}
+
+// Watch blocks until ctx is done, polling the given keyring file for changes at the
+// specified interval and reloading the keyring whenever the file is modified. If the
+// modified file is invalid, the error is logged and the previous keys remain in use.
+func (k *Keyring) Watch(ctx context.Context, path string, interval time.Duration, logger *slog.Logger) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat keyring file: %w", err)
+	}
+	modTime := info.ModTime()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			info, err := os.Stat(path)
+			if err != nil {
+				logger.Warn("Failed to check keyring file for changes", "path", path, "error", err)
+				continue
+			}
+			if info.ModTime().Equal(modTime) {
+				continue
+			}
+			modTime = info.ModTime()
+			if err := k.reloadFile(path); err != nil {
+				logger.Error("Failed to reload keyring; continuing to use previous keys", "path", path, "error", err)
+				continue
+			}
+			logger.Info("Reloaded keyring", "path", path, "currentKeyId", k.Current().ID)
+		}
+	}
+}
+
+// reloadFile replaces the contents of the keyring with the keys read from a JSON file
+func (k *Keyring) reloadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read keyring file: %w", err)
+	}
+	doc, err := parseKeyringDocument(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse keyring file %s: %w", path, err)
+	}
+	return k.Replace(doc.Current, doc.Keys...)
+}
+
+// parseKeyringDocument parses the JSON representation of a keyring
+func parseKeyringDocument(data []byte) (*keyringDocument, error) {
+	var doc keyringDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// keySource supplies the secrets used by signers and verifiers: either a single static
+// secret or a Keyring
+type keySource interface {
+	// signingKey returns the key that should be used to sign a new request
+	signingKey() Key
+
+	// verificationKey returns the key that should be used to verify a request with the
+	// given key ID (which may be empty, for requests from signers that predate key IDs)
+	verificationKey(id string) (Key, bool)
+}
+
+// staticKey is a keySource consisting of a single key with no key ID
+type staticKey Key
+
+func (s staticKey) signingKey() Key {
+	return Key(s)
+}
+
+func (s staticKey) verificationKey(id string) (Key, bool) {
+	return Key(s), true
+}
+
+// keyringSource is a keySource backed by a Keyring: requests that don't specify a key
+// ID are verified using the current key
+type keyringSource struct {
+	k *Keyring
+}
+
+func (s keyringSource) signingKey() Key {
+	return s.k.Current()
+}
+
+func (s keyringSource) verificationKey(id string) (Key, bool) {
+	if id == "" {
+		return s.k.Current(), true
+	}
+	return s.k.Lookup(id)
+}
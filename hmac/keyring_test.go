@@ -0,0 +1,138 @@
+package hmac
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Keyring(t *testing.T) {
+	t.Run("keyring must be internally consistent", func(t *testing.T) {
+		_, err := NewKeyring("a", Key{ID: "b", Secret: "secret-b"})
+		assert.Error(t, err)
+		_, err = NewKeyring("a", Key{ID: "a", Secret: "secret-a"}, Key{ID: "a", Secret: "other"})
+		assert.Error(t, err)
+		_, err = NewKeyring("a", Key{ID: "a"})
+		assert.Error(t, err)
+	})
+	t.Run("expired keys can't be looked up", func(t *testing.T) {
+		now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+		k, err := NewKeyring("new",
+			Key{ID: "new", Secret: "secret-new"},
+			Key{ID: "old", Secret: "secret-old", ExpiresAt: now.Add(time.Hour)},
+		)
+		assert.NoError(t, err)
+		k.now = func() time.Time { return now }
+
+		assert.Equal(t, "new", k.Current().ID)
+		_, ok := k.Lookup("old")
+		assert.True(t, ok)
+		now = now.Add(time.Hour)
+		_, ok = k.Lookup("old")
+		assert.False(t, ok)
+		_, ok = k.Lookup("nonexistent")
+		assert.False(t, ok)
+	})
+}
+
+func Test_Keyring_rotation(t *testing.T) {
+	body := []byte("hello world")
+	sign := func(s Signer) *http.Request {
+		req, err := http.NewRequest(http.MethodPost, "/somewhere", bytes.NewReader(body))
+		assert.NoError(t, err)
+		req, err = s.Sign(req, body)
+		assert.NoError(t, err)
+		return req
+	}
+
+	// Initially, all services share a single key
+	signerKeys, err := NewKeyring("k1", Key{ID: "k1", Secret: "secret-1"})
+	assert.NoError(t, err)
+	verifierKeys, err := NewKeyring("k1", Key{ID: "k1", Secret: "secret-1"})
+	assert.NoError(t, err)
+	s := NewKeyringSigner(signerKeys)
+	v := NewKeyringVerifier(verifierKeys)
+
+	req := sign(s)
+	assert.Equal(t, "k1", req.Header.Get(HeaderKeyId))
+	assert.NoError(t, v.Verify(req, body))
+
+	// Requests from legacy signers with no key ID are verified with the current key
+	assert.NoError(t, v.Verify(sign(NewSigner("secret-1")), body))
+
+	// The verifier learns about a new key before any signer starts using it
+	assert.NoError(t, verifierKeys.Replace("k1", Key{ID: "k1", Secret: "secret-1"}, Key{ID: "k2", Secret: "secret-2"}))
+	assert.NoError(t, v.Verify(sign(s), body))
+
+	// The signer switches to the new key, and the verifier accepts both keys during the
+	// grace period
+	inFlight := sign(s)
+	assert.NoError(t, signerKeys.Replace("k2", Key{ID: "k2", Secret: "secret-2"}))
+	req = sign(s)
+	assert.Equal(t, "k2", req.Header.Get(HeaderKeyId))
+	assert.NoError(t, v.Verify(req, body))
+	assert.NoError(t, v.Verify(inFlight, body))
+
+	// Once the old key expires, signatures made with it are rejected
+	assert.NoError(t, verifierKeys.Replace("k2",
+		Key{ID: "k1", Secret: "secret-1", ExpiresAt: time.Now().Add(-time.Second)},
+		Key{ID: "k2", Secret: "secret-2"},
+	))
+	assert.ErrorIs(t, v.Verify(inFlight, body), ErrVerificationFailed)
+	assert.NoError(t, v.Verify(sign(s), body))
+}
+
+func Test_LoadKeyring(t *testing.T) {
+	doc := `{"current":"k2","keys":[{"id":"k1","secret":"secret-1","expiresAt":"2999-01-01T00:00:00Z"},{"id":"k2","secret":"secret-2"}]}`
+
+	t.Run("keyring can be loaded from env", func(t *testing.T) {
+		t.Setenv("TEST_HMAC_KEYRING", doc)
+		k, err := LoadKeyringFromEnv("TEST_HMAC_KEYRING")
+		assert.NoError(t, err)
+		assert.Equal(t, "secret-2", k.Current().Secret)
+		_, ok := k.Lookup("k1")
+		assert.True(t, ok)
+
+		_, err = LoadKeyringFromEnv("TEST_HMAC_KEYRING_UNSET")
+		assert.Error(t, err)
+	})
+	t.Run("keyring file is reloaded on change", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "keyring.json")
+		assert.NoError(t, os.WriteFile(path, []byte(doc), 0600))
+		k, err := LoadKeyringFile(path)
+		assert.NoError(t, err)
+		assert.Equal(t, "k2", k.Current().ID)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+		go k.Watch(ctx, path, time.Millisecond, logger)
+
+		// An invalid file is ignored
+		assert.NoError(t, os.WriteFile(path, []byte(`{"current":"k3","keys":[]}`), 0600))
+		modTime := time.Now().Add(time.Minute)
+		assert.NoError(t, os.Chtimes(path, modTime, modTime))
+		time.Sleep(10 * time.Millisecond)
+		assert.Equal(t, "k2", k.Current().ID)
+
+		// A valid file replaces the keyring's contents
+		assert.NoError(t, os.WriteFile(path, []byte(`{"current":"k3","keys":[{"id":"k3","secret":"secret-3"}]}`), 0600))
+		modTime = modTime.Add(time.Minute)
+		assert.NoError(t, os.Chtimes(path, modTime, modTime))
+		deadline := time.Now().Add(time.Second)
+		for k.Current().ID != "k3" && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		assert.Equal(t, "k3", k.Current().ID)
+		_, ok := k.Lookup("k1")
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,135 @@
+package hmac
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+
+	"github.com/golden-vcr/server-common/entry"
+)
+
+// Principal describes the credentials with which a verified request was signed
+type Principal struct {
+	// KeyId identifies the keyring key that was used to sign the request; it's empty if
+	// the request was verified using a single static secret
+	KeyId string
+
+	// Caller is the name of the internal service that signed the request, if it was
+	// verified by a verifier created with NewCallerVerifier
+	Caller string
+
+	// Scopes lists the permissions granted to the caller
+	Scopes []string
+
+	// Algorithm is the algorithm used to compute the signature that was verified
+	Algorithm Algorithm
+}
+
+// HasScopes returns true if the principal has been granted all of the given scopes
+func (p *Principal) HasScopes(scopes ...string) bool {
+	for _, scope := range scopes {
+		if !slices.Contains(p.Scopes, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// PrincipalFromContext returns the Principal stored in the given context by
+// Middleware, if the request being handled was verified
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value("hmac-principal").(*Principal)
+	return principal, ok && principal != nil
+}
+
+// DefaultMaxBodyBytes is the largest request body that Middleware will buffer in order
+// to verify it, unless configured otherwise via WithMaxBodyBytes
+const DefaultMaxBodyBytes = 1 << 20
+
+// MiddlewareOption customizes the behavior of Middleware or EventSubMiddleware
+type MiddlewareOption func(*middlewareConfig)
+
+// middlewareConfig accumulates the settings specified via MiddlewareOption values
+type middlewareConfig struct {
+	maxBodyBytes int64
+}
+
+func newMiddlewareConfig(opts []MiddlewareOption) middlewareConfig {
+	c := middlewareConfig{maxBodyBytes: DefaultMaxBodyBytes}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// WithMaxBodyBytes sets the largest request body that will be buffered for
+// verification: requests with larger bodies are rejected with 413 Request Entity Too
+// Large, as with entry.LimitRequestBody
+func WithMaxBodyBytes(maxBytes int64) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.maxBodyBytes = maxBytes
+	}
+}
+
+// Middleware returns HTTP middleware that verifies the signature of every incoming
+// request using the given Verifier. Requests that fail verification are rejected with
+// a 401 error, and the reason for the failure is logged. Verified requests are passed
+// to the next handler with their body intact, and with a Principal stored in the
+// request context (see PrincipalFromContext): if v does not implement
+// PrincipalVerifier, the Principal is empty. Request bodies are buffered in memory,
+// up to DefaultMaxBodyBytes unless configured otherwise via WithMaxBodyBytes.
+func Middleware(v Verifier, opts ...MiddlewareOption) func(http.Handler) http.Handler {
+	config := newMiddlewareConfig(opts)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Buffer the request body so we can verify it and then pass it downstream
+			body, ok := readBody(w, r, config.maxBodyBytes)
+			if !ok {
+				return
+			}
+
+			principal, err := authenticate(v, r, body)
+			if err != nil {
+				entry.Log(r).Warn("Rejecting request with invalid HMAC signature", "error", err)
+				entry.WriteError(w, r, err)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), "hmac-principal", principal)
+			r = r.WithContext(ctx)
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// readBody reads and closes the body of r, which may be no larger than maxBytes. If the
+// body can't be read, an error response is written and false is returned.
+func readBody(w http.ResponseWriter, r *http.Request, maxBytes int64) ([]byte, bool) {
+	defer r.Body.Close()
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBytes))
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		entry.Log(r).Warn("Rejecting request with oversized body", "maxBytes", maxBytes)
+		entry.WriteError(w, r, &entry.Error{
+			Status:  http.StatusRequestEntityTooLarge,
+			Code:    "request_too_large",
+			Message: "request body is too large",
+			Details: map[string]any{"maxBytes": maxBytes},
+		})
+		return nil, false
+	}
+	if err != nil {
+		entry.WriteError(w, r, &entry.Error{
+			Status:  http.StatusBadRequest,
+			Code:    "invalid_request_body",
+			Message: "failed to read request body",
+			Err:     err,
+		})
+		return nil, false
+	}
+	return body, true
+}
@@ -0,0 +1,93 @@
+package hmac
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Middleware(t *testing.T) {
+	keyring, err := NewKeyring("k1", Key{ID: "k1", Secret: "my-secret"})
+	assert.NoError(t, err)
+	s := NewKeyringSigner(keyring)
+
+	var gotBody []byte
+	var gotPrincipal *Principal
+	h := Middleware(NewKeyringVerifier(keyring))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotBody, _ = io.ReadAll(r.Body)
+		gotPrincipal, _ = PrincipalFromContext(r.Context())
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	t.Run("verified request is passed downstream with its body and principal", func(t *testing.T) {
+		gotBody, gotPrincipal = nil, nil
+		body := []byte("hello world")
+		req := httptest.NewRequest(http.MethodPost, "/somewhere", bytes.NewReader(body))
+		req, err := s.Sign(req, body)
+		assert.NoError(t, err)
+
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		assert.Equal(t, http.StatusNoContent, res.Code)
+		assert.Equal(t, body, gotBody)
+		assert.Equal(t, &Principal{KeyId: "k1", Algorithm: AlgorithmHMACSHA256}, gotPrincipal)
+	})
+	t.Run("unverified request is rejected with 401", func(t *testing.T) {
+		gotBody, gotPrincipal = nil, nil
+		body := []byte("hello world")
+		req := httptest.NewRequest(http.MethodPost, "/somewhere", bytes.NewReader(body))
+		req, err := s.Sign(req, body)
+		assert.NoError(t, err)
+		req.Body = io.NopCloser(bytes.NewReader([]byte("tampered")))
+
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+		assert.Contains(t, res.Body.String(), `"code":"verification_failed"`)
+		assert.NotContains(t, res.Body.String(), "signature does not match")
+		assert.Nil(t, gotBody)
+		assert.Nil(t, gotPrincipal)
+	})
+	t.Run("request with oversized body is rejected with 413", func(t *testing.T) {
+		called := false
+		h := Middleware(NewKeyringVerifier(keyring), WithMaxBodyBytes(8))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		}))
+		body := []byte("hello world")
+		req := httptest.NewRequest(http.MethodPost, "/somewhere", bytes.NewReader(body))
+		req, err := s.Sign(req, body)
+		assert.NoError(t, err)
+
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, res.Code)
+		assert.Contains(t, res.Body.String(), `"code":"request_too_large"`)
+		assert.False(t, called)
+	})
+	t.Run("verifier without principals yields an empty principal", func(t *testing.T) {
+		var gotPrincipal *Principal
+		h := Middleware(verifyOnlyVerifier{NewKeyringVerifier(keyring)})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotPrincipal, _ = PrincipalFromContext(r.Context())
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		body := []byte("hello world")
+		req := httptest.NewRequest(http.MethodPost, "/somewhere", bytes.NewReader(body))
+		req, err := s.Sign(req, body)
+		assert.NoError(t, err)
+
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		assert.Equal(t, http.StatusNoContent, res.Code)
+		assert.Equal(t, &Principal{}, gotPrincipal)
+	})
+}
+
+// verifyOnlyVerifier is a Verifier that exposes none of the optional verification
+// capabilities
+type verifyOnlyVerifier struct {
+	Verifier
+}
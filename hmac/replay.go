@@ -0,0 +1,67 @@
+package hmac
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultMaxClockSkew is the window applied to request timestamps when a NonceStore is
+// configured without an explicit window via WithMaxClockSkew
+const DefaultMaxClockSkew = 5 * time.Minute
+
+// NonceStore records the request IDs of verified requests, so that a verifier can
+// reject any request whose ID has already been used. Request IDs only need to be
+// remembered until their request timestamp falls outside the verifier's clock-skew
+// window, since any replay after that point will be rejected as expired.
+type NonceStore interface {
+	// Claim records that the given request ID has been used, until expiresAt. Returns
+	// true if the ID was successfully claimed, or false if it has already been claimed
+	// and that claim has not yet expired.
+	Claim(ctx context.Context, requestId string, expiresAt time.Time) (bool, error)
+}
+
+// memoryNonceStore is a NonceStore that keeps request IDs in memory: it's suitable for
+// services that run as a single process
+type memoryNonceStore struct {
+	now func() time.Time
+
+	mu        sync.Mutex
+	expiries  map[string]time.Time
+	lastSweep time.Time
+}
+
+// memoryNonceStoreSweepInterval is how often a memoryNonceStore discards expired
+// request IDs
+const memoryNonceStoreSweepInterval = time.Minute
+
+// NewMemoryNonceStore initializes a NonceStore that keeps request IDs in memory
+func NewMemoryNonceStore() NonceStore {
+	return &memoryNonceStore{
+		now:      time.Now,
+		expiries: make(map[string]time.Time),
+	}
+}
+
+func (s *memoryNonceStore) Claim(ctx context.Context, requestId string, expiresAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.lastSweep) >= memoryNonceStoreSweepInterval {
+		s.lastSweep = now
+		for id, expiry := range s.expiries {
+			if !now.Before(expiry) {
+				delete(s.expiries, id)
+			}
+		}
+	}
+
+	if expiry, ok := s.expiries[requestId]; ok && now.Before(expiry) {
+		return false, nil
+	}
+	s.expiries[requestId] = expiresAt
+	return true, nil
+}
+
+var _ NonceStore = (*memoryNonceStore)(nil)
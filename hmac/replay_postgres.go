@@ -0,0 +1,92 @@
+package hmac
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// Execer is satisfied by both *sql.DB and *sql.Tx
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// PostgresNonceStore is a NonceStore that records request IDs in a PostgreSQL table,
+// so that replays can be detected across multiple replicas of a service. The table
+// must have the following schema, which may be created via CreateTable (or, preferably,
+// via the service's database migrations):
+//
+//	CREATE TABLE <table> (
+//	    request_id text PRIMARY KEY,
+//	    expires_at timestamptz NOT NULL
+//	);
+type PostgresNonceStore struct {
+	db    Execer
+	table string
+	now   func() time.Time
+}
+
+// postgresIdentifierRegex matches the table names accepted by NewPostgresNonceStore,
+// which are interpolated directly into queries
+var postgresIdentifierRegex = regexp.MustCompile(`^[a-z_][a-z0-9_]*(\.[a-z_][a-z0-9_]*)?$`)
+
+// NewPostgresNonceStore initializes a NonceStore backed by the given table
+func NewPostgresNonceStore(db Execer, table string) (*PostgresNonceStore, error) {
+	if !postgresIdentifierRegex.MatchString(table) {
+		return nil, fmt.Errorf("invalid table name '%s'", table)
+	}
+	return &PostgresNonceStore{
+		db:    db,
+		table: table,
+		now:   time.Now,
+	}, nil
+}
+
+// CreateTable creates the store's table, if it does not already exist
+func (s *PostgresNonceStore) CreateTable(ctx context.Context) error {
+	q := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			request_id text PRIMARY KEY,
+			expires_at timestamptz NOT NULL
+		)
+	`, s.table)
+	if _, err := s.db.ExecContext(ctx, q); err != nil {
+		return fmt.Errorf("failed to create nonce table: %w", err)
+	}
+	return nil
+}
+
+// Claim inserts a row for the given request ID, or replaces an existing row if it has
+// expired: if an unexpired row already exists, no rows are affected
+func (s *PostgresNonceStore) Claim(ctx context.Context, requestId string, expiresAt time.Time) (bool, error) {
+	// The table is aliased so that the existing row can be referenced unambiguously,
+	// even if the table name is schema-qualified
+	q := fmt.Sprintf(`
+		INSERT INTO %s AS existing (request_id, expires_at) VALUES ($1, $2)
+		ON CONFLICT (request_id) DO UPDATE SET expires_at = excluded.expires_at
+		WHERE existing.expires_at <= $3
+	`, s.table)
+	res, err := s.db.ExecContext(ctx, q, requestId, expiresAt, s.now())
+	if err != nil {
+		return false, fmt.Errorf("failed to record request ID: %w", err)
+	}
+	numRows, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get number of rows affected: %w", err)
+	}
+	return numRows == 1, nil
+}
+
+// Prune deletes all expired rows from the store's table: it should be called
+// periodically to keep the table from growing without bound
+func (s *PostgresNonceStore) Prune(ctx context.Context) error {
+	q := fmt.Sprintf(`DELETE FROM %s WHERE expires_at <= $1`, s.table)
+	if _, err := s.db.ExecContext(ctx, q, s.now()); err != nil {
+		return fmt.Errorf("failed to prune expired request IDs: %w", err)
+	}
+	return nil
+}
+
+var _ NonceStore = (*PostgresNonceStore)(nil)
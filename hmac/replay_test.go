@@ -0,0 +1,158 @@
+package hmac
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golden-vcr/server-common/querytest"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Verify_replayProtection(t *testing.T) {
+	s := NewSigner("my-secret", WithInPlaceSigning())
+	body := []byte("hello world")
+	newSignedRequest := func(timestamp time.Time) *http.Request {
+		req, err := http.NewRequest(http.MethodPost, "/somewhere", bytes.NewReader(body))
+		assert.NoError(t, err)
+		req.Header.Set(HeaderRequestTimestamp, timestamp.Format(time.RFC3339))
+		req, err = s.Sign(req, body)
+		assert.NoError(t, err)
+		return req
+	}
+
+	t.Run("requests with timestamps outside the window are rejected", func(t *testing.T) {
+		v := NewVerifier("my-secret", WithMaxClockSkew(time.Minute))
+
+		err := v.Verify(newSignedRequest(time.Now()), body)
+		assert.NoError(t, err)
+
+		err = v.Verify(newSignedRequest(time.Now().Add(-2*time.Minute)), body)
+		assert.ErrorIs(t, err, ErrTimestampOutOfRange)
+		assert.ErrorIs(t, err, ErrVerificationFailed)
+
+		err = v.Verify(newSignedRequest(time.Now().Add(2*time.Minute)), body)
+		assert.ErrorIs(t, err, ErrTimestampOutOfRange)
+	})
+
+	t.Run("requests with reused IDs are rejected", func(t *testing.T) {
+		v := NewVerifier("my-secret", WithNonceStore(NewMemoryNonceStore()))
+
+		req := newSignedRequest(time.Now())
+		err := v.Verify(req, body)
+		assert.NoError(t, err)
+
+		err = v.Verify(req, body)
+		assert.ErrorIs(t, err, ErrReplayedRequest)
+		assert.ErrorIs(t, err, ErrVerificationFailed)
+
+		err = v.Verify(newSignedRequest(time.Now()), body)
+		assert.NoError(t, err)
+	})
+
+	t.Run("request IDs are not claimed by requests with invalid signatures", func(t *testing.T) {
+		v := NewVerifier("my-secret", WithNonceStore(NewMemoryNonceStore()))
+
+		req := newSignedRequest(time.Now())
+		err := v.Verify(req, []byte("tampered body"))
+		assert.ErrorIs(t, err, ErrVerificationFailed)
+		assert.NotErrorIs(t, err, ErrReplayedRequest)
+
+		err = v.Verify(req, body)
+		assert.NoError(t, err)
+	})
+}
+
+func Test_memoryNonceStore(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := NewMemoryNonceStore().(*memoryNonceStore)
+	s.now = func() time.Time { return now }
+
+	claimed, err := s.Claim(context.Background(), "foo", now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.True(t, claimed)
+
+	claimed, err = s.Claim(context.Background(), "foo", now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.False(t, claimed)
+
+	now = now.Add(time.Minute)
+	claimed, err = s.Claim(context.Background(), "foo", now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.True(t, claimed)
+
+	now = now.Add(2 * memoryNonceStoreSweepInterval)
+	_, err = s.Claim(context.Background(), "bar", now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Len(t, s.expiries, 1)
+}
+
+func Test_PostgresNonceStore(t *testing.T) {
+	tx := querytest.PrepareTx(t)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	s, err := NewPostgresNonceStore(tx, "hmac_nonce_test")
+	assert.NoError(t, err)
+	s.now = func() time.Time { return now }
+	assert.NoError(t, s.CreateTable(context.Background()))
+
+	claimed, err := s.Claim(context.Background(), "foo", now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.True(t, claimed)
+
+	claimed, err = s.Claim(context.Background(), "foo", now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.False(t, claimed)
+
+	now = now.Add(time.Minute)
+	claimed, err = s.Claim(context.Background(), "foo", now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.True(t, claimed)
+
+	now = now.Add(time.Minute)
+	assert.NoError(t, s.Prune(context.Background()))
+	querytest.AssertCount(t, tx, 0, "SELECT COUNT(*) FROM hmac_nonce_test")
+}
+
+func Test_PostgresNonceStore_Claim(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	db := &recordingExecer{rowsAffected: 1}
+	s, err := NewPostgresNonceStore(db, "auth.hmac_nonces")
+	assert.NoError(t, err)
+	s.now = func() time.Time { return now }
+
+	claimed, err := s.Claim(context.Background(), "foo", now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.True(t, claimed)
+	assert.Contains(t, db.query, "INSERT INTO auth.hmac_nonces AS existing (request_id, expires_at)")
+	assert.Contains(t, db.query, "WHERE existing.expires_at <= $3")
+	assert.Equal(t, []any{"foo", now.Add(time.Minute), now}, db.args)
+
+	db.rowsAffected = 0
+	claimed, err = s.Claim(context.Background(), "foo", now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.False(t, claimed)
+}
+
+func Test_NewPostgresNonceStore(t *testing.T) {
+	_, err := NewPostgresNonceStore(nil, "nonces; DROP TABLE users")
+	assert.Error(t, err)
+	_, err = NewPostgresNonceStore(nil, "auth.hmac_nonces")
+	assert.NoError(t, err)
+}
+
+// recordingExecer is an Execer that records the last statement it was asked to execute
+type recordingExecer struct {
+	rowsAffected int64
+	query        string
+	args         []any
+}
+
+func (e *recordingExecer) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	e.query = query
+	e.args = args
+	return driver.RowsAffected(e.rowsAffected), nil
+}
@@ -0,0 +1,82 @@
+package hmac
+
+import "bytes"
+
+// MessageComponent identifies one of the values concatenated to form the message signed
+// by a SignatureV1 signature
+type MessageComponent int
+
+const (
+	ComponentRequestId MessageComponent = iota
+	ComponentTimestamp
+	ComponentBody
+)
+
+// Scheme describes how a SignatureV1-style signature is carried in HTTP headers: i.e.
+// which headers hold the request ID, timestamp, and signature, and the order in which
+// values are concatenated to form the signed message. This allows signatures produced
+// by third parties using a similar scheme (such as Twitch EventSub webhooks) to be
+// verified with a Verifier.
+type Scheme struct {
+	RequestIdHeader string
+	TimestampHeader string
+	SignatureHeader string
+
+	// MessageComponents lists the values that are concatenated, in order, to form the
+	// signed message
+	MessageComponents []MessageComponent
+}
+
+// DefaultScheme is the scheme used by Signer and Verifier unless otherwise configured
+var DefaultScheme = Scheme{
+	RequestIdHeader:   HeaderRequestId,
+	TimestampHeader:   HeaderRequestTimestamp,
+	SignatureHeader:   HeaderSignature,
+	MessageComponents: []MessageComponent{ComponentRequestId, ComponentTimestamp, ComponentBody},
+}
+
+// WithSigningScheme causes the signer to use the header names and message format
+// described by the given scheme
+func WithSigningScheme(scheme Scheme) SignerOption {
+	return func(s *signer) {
+		s.scheme = scheme
+	}
+}
+
+// WithVerificationScheme causes the verifier to use the header names and message
+// format described by the given scheme
+func WithVerificationScheme(scheme Scheme) VerifierOption {
+	return func(v *verifier) {
+		v.scheme = scheme
+	}
+}
+
+// reservedMessagePrefix begins every message signed by signatures of other formats
+// (see messageV2, messageGRPC, and messageURL). SignatureV1 messages are unprefixed, so
+// a V1 message that begins with it is refused: otherwise a signature of one of those
+// messages could be presented as a V1 signature, with the request ID, timestamp, and
+// body chosen so that they concatenate to form the same message.
+const reservedMessagePrefix = "HMAC-"
+
+// isReservedMessage returns true if the given SignatureV1 message begins with
+// reservedMessagePrefix
+func isReservedMessage(message []byte) bool {
+	return bytes.HasPrefix(message, []byte(reservedMessagePrefix))
+}
+
+// messageV1 returns the message signed by a SignatureV1 signature: the concatenation of
+// the request ID, timestamp, and body, in the order given by the scheme
+func (s Scheme) messageV1(requestId, timestamp string, body []byte) []byte {
+	message := make([]byte, 0, len(requestId)+len(timestamp)+len(body))
+	for _, component := range s.MessageComponents {
+		switch component {
+		case ComponentRequestId:
+			message = append(message, requestId...)
+		case ComponentTimestamp:
+			message = append(message, timestamp...)
+		case ComponentBody:
+			message = append(message, body...)
+		}
+	}
+	return message
+}
@@ -1,56 +1,223 @@
 package hmac
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
+	"bytes"
+	"crypto/ed25519"
 	"fmt"
+	"io"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type Signer interface {
+	// Sign returns a signed copy of req, whose body is reset to the given body (with
+	// GetBody set so that it can be retried or redirected). The original request is not
+	// modified, and each call signs the request with a new request ID and timestamp, so
+	// a request can be safely re-signed before each retry.
 	Sign(req *http.Request, body []byte) (*http.Request, error)
 }
 
-func NewSigner(secret string) Signer {
-	return &signer{
-		secret: secret,
+// SignerOption customizes the behavior of a Signer
+type SignerOption func(*signer)
+
+// WithSignatureV2 causes the signer to produce SignatureV2 signatures, which cover the
+// request method, path, and query in addition to the request ID, timestamp, and body.
+// Any headers named in signedHeaders are also covered by the signature (the Host
+// header may be included even though it's not stored in req.Header).
+func WithSignatureV2(signedHeaders ...string) SignerOption {
+	return func(s *signer) {
+		s.version = SignatureV2
+		s.signedHeaders = normalizeHeaderNames(signedHeaders)
+	}
+}
+
+// WithCallerId causes the signer to identify the calling service in HeaderCallerId, so
+// that a verifier configured via NewCallerVerifier can verify the request using that
+// caller's secret
+func WithCallerId(callerId string) SignerOption {
+	return func(s *signer) {
+		s.callerId = callerId
 	}
 }
 
+// WithAlgorithms causes the signer to sign each request using all of the given
+// algorithms, sending each resulting signature in HeaderSignature (separated by
+// commas). Signing with several algorithms allows verifiers to be migrated from one
+// algorithm to another independently of signers.
+func WithAlgorithms(algorithms ...Algorithm) SignerOption {
+	return func(s *signer) {
+		s.algorithms = algorithms
+	}
+}
+
+// WithInPlaceSigning restores the behavior of earlier versions of Sign, for callers
+// that depend on it: the signer sets its headers directly on the given request and
+// returns that same request, and if the request already carries a request ID or
+// timestamp, those values are reused rather than replaced
+func WithInPlaceSigning() SignerOption {
+	return func(s *signer) {
+		s.inPlace = true
+	}
+}
+
+func NewSigner(secret string, opts ...SignerOption) Signer {
+	return newSigner(staticKey(Key{Secret: secret}), opts)
+}
+
+// NewEd25519Signer initializes a Signer that signs requests with the given Ed25519
+// private key, so that they can be verified by a verifier that holds only the
+// corresponding public key
+func NewEd25519Signer(privateKey ed25519.PrivateKey, opts ...SignerOption) Signer {
+	return newSigner(staticKey(Key{PrivateKey: privateKey}), opts)
+}
+
+// NewKeyringSigner initializes a Signer that signs each request with the keyring's
+// current key, identifying that key in HeaderKeyId
+func NewKeyringSigner(keyring *Keyring, opts ...SignerOption) Signer {
+	return newSigner(keyringSource{keyring}, opts)
+}
+
+func newSigner(keys keySource, opts []SignerOption) *signer {
+	s := &signer{
+		keys:    keys,
+		version: SignatureV1,
+		scheme:  DefaultScheme,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
 type signer struct {
-	secret string
+	keys          keySource
+	version       SignatureVersion
+	signedHeaders []string
+	callerId      string
+	algorithms    []Algorithm
+	scheme        Scheme
+	inPlace       bool
 }
 
 func (s *signer) Sign(req *http.Request, body []byte) (*http.Request, error) {
-	requestId := req.Header.Get(HeaderRequestId)
+	if s.inPlace {
+		if err := s.signHeaders(req, body); err != nil {
+			return nil, err
+		}
+		return req, nil
+	}
+
+	// Sign a copy of the request, discarding any headers left over from a previous
+	// signing so that the copy gets a fresh request ID and timestamp
+	signed := req.Clone(req.Context())
+	setBufferedBody(signed, body)
+	for _, name := range []string{s.scheme.RequestIdHeader, s.scheme.TimestampHeader, s.scheme.SignatureHeader, HeaderSignedHeaders, HeaderKeyId, HeaderCallerId} {
+		signed.Header.Del(name)
+	}
+	if err := s.signHeaders(signed, body); err != nil {
+		return nil, err
+	}
+	return signed, nil
+}
+
+// signHeaders signs the given request in place, setting a new request ID and timestamp
+// only if the request doesn't already carry them
+func (s *signer) signHeaders(req *http.Request, body []byte) error {
+	requestId := req.Header.Get(s.scheme.RequestIdHeader)
 	if requestId == "" {
 		requestId = uuid.NewString()
-		req.Header.Set(HeaderRequestId, requestId)
+		req.Header.Set(s.scheme.RequestIdHeader, requestId)
 	}
 
-	timestamp := req.Header.Get(HeaderRequestTimestamp)
+	timestamp := req.Header.Get(s.scheme.TimestampHeader)
 	if timestamp == "" {
 		timestamp = time.Now().Format(time.RFC3339)
-		req.Header.Set(HeaderRequestTimestamp, timestamp)
+		req.Header.Set(s.scheme.TimestampHeader, timestamp)
+	}
+
+	key := s.keys.signingKey()
+	if key.ID != "" {
+		req.Header.Set(HeaderKeyId, key.ID)
+	}
+	if s.callerId != "" {
+		req.Header.Set(HeaderCallerId, s.callerId)
+	}
+
+	var message []byte
+	switch s.version {
+	case SignatureV1:
+		message = s.scheme.messageV1(requestId, timestamp, body)
+		if isReservedMessage(message) {
+			return fmt.Errorf("refusing to sign SignatureV1 message beginning with '%s'", reservedMessagePrefix)
+		}
+	case SignatureV2:
+		req.Header.Set(HeaderSignedHeaders, strings.Join(s.signedHeaders, ";"))
+		message = messageV2(req, requestId, timestamp, s.signedHeaders, sha256Digest(body))
+	default:
+		return fmt.Errorf("unsupported signature version %d", s.version)
 	}
 
-	hash := hmac.New(sha256.New, []byte(s.secret))
-	if _, err := hash.Write([]byte(requestId)); err != nil {
-		return nil, fmt.Errorf("failed to write request ID to hash: %w", err)
+	signature, err := s.sign(formatForVersion(s.version), key, message)
+	if err != nil {
+		return err
 	}
-	if _, err := hash.Write([]byte(timestamp)); err != nil {
-		return nil, fmt.Errorf("failed to write timestamp string to hash: %w", err)
+	req.Header.Set(s.scheme.SignatureHeader, signature)
+	return nil
+}
+
+// setBufferedBody replaces the body of the given request with one that reads from the
+// given buffer, setting GetBody so that the body can be rewound as needed
+func setBufferedBody(req *http.Request, body []byte) {
+	if len(body) == 0 {
+		req.Body = http.NoBody
+		req.GetBody = func() (io.ReadCloser, error) { return http.NoBody, nil }
+		req.ContentLength = 0
+		return
+	}
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	req.Body, _ = req.GetBody()
+	req.ContentLength = int64(len(body))
+}
+
+// sign signs message with the given key using each of the signer's algorithms,
+// returning the resulting signatures formatted as the value of HeaderSignature
+func (s *signer) sign(format signatureFormat, key Key, message []byte) (string, error) {
+	algorithms, err := s.algorithmsFor(key)
+	if err != nil {
+		return "", err
+	}
+	signatures := make([]signature, 0, len(algorithms))
+	for _, alg := range algorithms {
+		value, err := computeSignature(alg, key, message)
+		if err != nil {
+			return "", err
+		}
+		signatures = append(signatures, signature{format: format, algorithm: alg, value: value})
+	}
+	return formatSignatures(signatures), nil
+}
+
+// algorithmsFor returns the algorithms with which the signer should sign requests
+// using the given key: if none were configured via WithAlgorithms, keys with only an
+// Ed25519 private key use AlgorithmEd25519, and all other keys use AlgorithmHMACSHA256
+func (s *signer) algorithmsFor(key Key) ([]Algorithm, error) {
+	if len(s.algorithms) == 0 {
+		if key.Secret == "" && len(key.PrivateKey) > 0 {
+			return []Algorithm{AlgorithmEd25519}, nil
+		}
+		return []Algorithm{AlgorithmHMACSHA256}, nil
 	}
-	if _, err := hash.Write(body); err != nil {
-		return nil, fmt.Errorf("failed to write request body to hash: %w", err)
+	for _, alg := range s.algorithms {
+		if !key.supportsAlgorithm(alg) || (alg == AlgorithmEd25519 && len(key.PrivateKey) == 0) {
+			return nil, fmt.Errorf("signing key '%s' can't be used for %s signatures", key.ID, alg)
+		}
 	}
-	signature := fmt.Sprintf("sha256=%s", hex.EncodeToString(hash.Sum(nil)))
-	req.Header.Set(HeaderSignature, signature)
-	return req, nil
+	return s.algorithms, nil
 }
 
 var _ Signer = (*signer)(nil)
@@ -42,15 +42,52 @@ func Test_Sign(t *testing.T) {
 	})
 
 	t.Run("signature is computed as expected", func(t *testing.T) {
-		// Sign another request, this time with pre-filled ID and timestamp so the
-		// signature is deterministic
+		// Sign another request in place, this time with pre-filled ID and timestamp so
+		// the signature is deterministic
 		body := []byte("hello world")
 		req, err := http.NewRequest(http.MethodPost, "/somewhere", bytes.NewReader(body))
 		assert.NoError(t, err)
 		req.Header.Set(HeaderRequestId, "d6c6a6d0-bb4e-4ff2-8188-4dda238f9223")
 		req.Header.Set(HeaderRequestTimestamp, "2023-12-06T21:06:04+00:00")
-		req, err = s.Sign(req, body)
+		signed, err := NewSigner("my-secret", WithInPlaceSigning()).Sign(req, body)
 		assert.NoError(t, err)
+		assert.Same(t, req, signed)
 		assert.Equal(t, "sha256=d1550fb3eea5eb856f5d0297f45568dfb19cfa4f4df3bb8a02e57487a6a8951b", req.Header.Get(HeaderSignature))
 	})
+
+	t.Run("original request is not modified", func(t *testing.T) {
+		body := []byte("hello world")
+		req, err := http.NewRequest(http.MethodPost, "/somewhere", bytes.NewReader(body))
+		assert.NoError(t, err)
+		signed, err := s.Sign(req, body)
+		assert.NoError(t, err)
+		assert.NotSame(t, req, signed)
+		assert.Empty(t, req.Header.Get(HeaderSignature))
+		assert.NotEmpty(t, signed.Header.Get(HeaderSignature))
+	})
+
+	t.Run("re-signing a signed request produces a fresh request ID", func(t *testing.T) {
+		body := []byte("hello world")
+		req, err := http.NewRequest(http.MethodPost, "/somewhere", bytes.NewReader(body))
+		assert.NoError(t, err)
+		first, err := s.Sign(req, body)
+		assert.NoError(t, err)
+		_, err = io.ReadAll(first.Body)
+		assert.NoError(t, err)
+
+		second, err := s.Sign(first, body)
+		assert.NoError(t, err)
+		assert.NotEqual(t, first.Header.Get(HeaderRequestId), second.Header.Get(HeaderRequestId))
+		assert.NoError(t, NewVerifier("my-secret").Verify(second, body))
+
+		// Verify that the re-signed request's body has been reset, and can be rewound
+		bodyCopy, err := io.ReadAll(second.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, body, bodyCopy)
+		rewound, err := second.GetBody()
+		assert.NoError(t, err)
+		bodyCopy, err = io.ReadAll(rewound)
+		assert.NoError(t, err)
+		assert.Equal(t, body, bodyCopy)
+	})
 }
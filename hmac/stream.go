@@ -0,0 +1,270 @@
+package hmac
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golden-vcr/server-common/entry"
+	"github.com/google/uuid"
+)
+
+// ErrBodyNotConsumed is returned by VerifiedBody.Principal if the request body has not
+// yet been read to EOF, in which case its signature has not yet been verified
+var ErrBodyNotConsumed = errors.New("request body has not been fully read")
+
+// StreamSigner is implemented by Signers that can sign requests without buffering their
+// bodies, including every Signer created by this package
+type StreamSigner interface {
+	// SignStream signs a request without buffering its body, returning a copy of the
+	// request whose SignatureV2 signature is sent in a trailer
+	SignStream(req *http.Request) (*http.Request, error)
+}
+
+// StreamVerifier is implemented by Verifiers that can verify requests without
+// buffering their bodies, including every Verifier created by this package
+type StreamVerifier interface {
+	// VerifyStream prepares to verify a request without buffering its body, returning a
+	// VerifiedBody that reports the result of verification once it's read to EOF
+	VerifyStream(req *http.Request) (*VerifiedBody, error)
+}
+
+// SignStream signs a request whose body is streamed rather than held in memory. The
+// body is hashed as it's sent, and the resulting SignatureV2 signature is carried in
+// an HTTP trailer rather than a header. The returned request is sent with chunked
+// encoding, and its body can't be rewound for retries.
+func (s *signer) SignStream(req *http.Request) (*http.Request, error) {
+	signed := req.Clone(req.Context())
+
+	requestId := signed.Header.Get(s.scheme.RequestIdHeader)
+	if requestId == "" {
+		requestId = uuid.NewString()
+		signed.Header.Set(s.scheme.RequestIdHeader, requestId)
+	}
+
+	timestamp := signed.Header.Get(s.scheme.TimestampHeader)
+	if timestamp == "" {
+		timestamp = time.Now().Format(time.RFC3339)
+		signed.Header.Set(s.scheme.TimestampHeader, timestamp)
+	}
+
+	key := s.keys.signingKey()
+	if key.ID != "" {
+		signed.Header.Set(HeaderKeyId, key.ID)
+	}
+	if s.callerId != "" {
+		signed.Header.Set(HeaderCallerId, s.callerId)
+	}
+	signed.Header.Set(HeaderSignedHeaders, strings.Join(s.signedHeaders, ";"))
+	signed.Header.Del(s.scheme.SignatureHeader)
+
+	if _, err := s.algorithmsFor(key); err != nil {
+		return nil, err
+	}
+	sign := func(bodyDigest []byte) (string, error) {
+		message := messageV2(signed, requestId, timestamp, s.signedHeaders, bodyDigest)
+		return s.sign(formatV2, key, message)
+	}
+
+	// A request with no body can simply be signed up-front
+	if req.Body == nil || req.Body == http.NoBody {
+		signature, err := sign(sha256Digest(nil))
+		if err != nil {
+			return nil, err
+		}
+		signed.Header.Set(s.scheme.SignatureHeader, signature)
+		return signed, nil
+	}
+
+	// Otherwise, declare the signature as a trailer, and fill in its value once the
+	// transport has read the entire body
+	signed.Trailer = http.Header{http.CanonicalHeaderKey(s.scheme.SignatureHeader): nil}
+	signed.ContentLength = -1
+	signed.GetBody = nil
+	signed.Body = &signingBody{
+		body: req.Body,
+		hash: sha256.New(),
+		onEOF: func(bodyDigest []byte) {
+			// We've already checked that the key supports our algorithms, so signing
+			// can't fail at this point
+			signature, _ := sign(bodyDigest)
+			signed.Trailer.Set(s.scheme.SignatureHeader, signature)
+		},
+	}
+	return signed, nil
+}
+
+// signingBody hashes a request body as it's read, calling onEOF with the final digest
+// before reporting EOF to the reader
+type signingBody struct {
+	body  io.ReadCloser
+	hash  hash.Hash
+	onEOF func(bodyDigest []byte)
+	done  bool
+}
+
+func (b *signingBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	b.hash.Write(p[:n])
+	if err == io.EOF && !b.done {
+		b.done = true
+		b.onEOF(b.hash.Sum(nil))
+	}
+	return n, err
+}
+
+func (b *signingBody) Close() error {
+	return b.body.Close()
+}
+
+// VerifiedBody wraps the body of an incoming request, hashing it as it's read. Once the
+// underlying body reaches EOF, the request's signature is verified: if verification
+// fails, Read returns the verification error in lieu of io.EOF. Handlers must therefore
+// treat the body as untrusted, and refrain from committing any side effects, until
+// Read has returned io.EOF (or Principal has returned without error).
+type VerifiedBody struct {
+	v           *verifier
+	req         *http.Request
+	body        io.ReadCloser
+	hash        hash.Hash
+	requestId   string
+	timestamp   string
+	requestTime time.Time
+
+	done      bool
+	principal *Principal
+	err       error
+}
+
+func (v *verifier) VerifyStream(req *http.Request) (*VerifiedBody, error) {
+	requestId := req.Header.Get(v.scheme.RequestIdHeader)
+	if requestId == "" {
+		return nil, fmt.Errorf("%w: %s", ErrMissingHeader, v.scheme.RequestIdHeader)
+	}
+
+	timestamp := req.Header.Get(v.scheme.TimestampHeader)
+	if timestamp == "" {
+		return nil, fmt.Errorf("%w: %s", ErrMissingHeader, v.scheme.TimestampHeader)
+	}
+
+	requestTime, err := v.checkTimestamp(timestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	// The signature may be supplied up-front in a header, or declared as a trailer; in
+	// either case it must be a SignatureV2 signature, since only those cover the body
+	// via its digest
+	if value := req.Header.Get(v.scheme.SignatureHeader); value != "" {
+		if !slices.ContainsFunc(parseSignatures(value), func(sig signature) bool { return sig.format == formatV2 }) {
+			return nil, fmt.Errorf("%w: streamed requests require a SignatureV2 signature", ErrMalformedSignature)
+		}
+	} else if _, declared := req.Trailer[http.CanonicalHeaderKey(v.scheme.SignatureHeader)]; !declared {
+		return nil, fmt.Errorf("%w: %s (in headers or trailers)", ErrMissingHeader, v.scheme.SignatureHeader)
+	}
+
+	body := req.Body
+	if body == nil {
+		body = http.NoBody
+	}
+	return &VerifiedBody{
+		v:           v,
+		req:         req,
+		body:        body,
+		hash:        sha256.New(),
+		requestId:   requestId,
+		timestamp:   timestamp,
+		requestTime: requestTime,
+	}, nil
+}
+
+func (b *VerifiedBody) Read(p []byte) (int, error) {
+	if b.done {
+		if b.err != nil {
+			return 0, b.err
+		}
+		return 0, io.EOF
+	}
+
+	n, err := b.body.Read(p)
+	b.hash.Write(p[:n])
+	if err == io.EOF {
+		b.finish()
+		if b.err != nil {
+			return n, b.err
+		}
+	}
+	return n, err
+}
+
+func (b *VerifiedBody) Close() error {
+	return b.body.Close()
+}
+
+// Principal returns the credentials with which the request was signed, once the body
+// has been read to EOF and its signature has been verified
+func (b *VerifiedBody) Principal() (*Principal, error) {
+	if !b.done {
+		return nil, ErrBodyNotConsumed
+	}
+	return b.principal, b.err
+}
+
+// finish verifies the request's signature once the entire body has been hashed
+func (b *VerifiedBody) finish() {
+	b.done = true
+
+	value := b.req.Header.Get(b.v.scheme.SignatureHeader)
+	if value == "" {
+		value = b.req.Trailer.Get(b.v.scheme.SignatureHeader)
+	}
+	if value == "" {
+		b.err = fmt.Errorf("%w: %s (in trailers)", ErrMissingHeader, b.v.scheme.SignatureHeader)
+		return
+	}
+	signedHeaders := parseSignedHeaders(b.req.Header.Get(HeaderSignedHeaders))
+	message := messageV2(b.req, b.requestId, b.timestamp, signedHeaders, b.hash.Sum(nil))
+	b.principal, b.err = b.v.checkSignature(b.req.Context(), entry.Log(b.req), credentials{
+		requestId:   b.requestId,
+		requestTime: b.requestTime,
+		keyId:       b.req.Header.Get(HeaderKeyId),
+		callerId:    b.req.Header.Get(HeaderCallerId),
+		signatures:  parseSignatures(value),
+	}, map[signatureFormat][]byte{formatV2: message})
+}
+
+// StreamingMiddleware returns HTTP middleware that replaces the body of each incoming
+// request with a *VerifiedBody, without buffering it. Requests that are missing the
+// required signature headers are rejected with a 401 error immediately; otherwise, the
+// next handler is responsible for reading the body to EOF before acting on it, and for
+// reporting any verification error returned from Read (e.g. via entry.WriteError).
+// Requests fail with a 500 error if v does not implement StreamVerifier.
+func StreamingMiddleware(v Verifier) func(http.Handler) http.Handler {
+	streamVerifier, ok := v.(StreamVerifier)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !ok {
+				entry.WriteError(w, r, fmt.Errorf("verifier does not support verifying streamed requests"))
+				return
+			}
+			body, err := streamVerifier.VerifyStream(r)
+			if err != nil {
+				entry.Log(r).Warn("Rejecting request with invalid HMAC signature", "error", err)
+				entry.WriteError(w, r, err)
+				return
+			}
+			r.Body = body
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+var _ StreamSigner = (*signer)(nil)
+var _ StreamVerifier = (*verifier)(nil)
+var _ io.ReadCloser = (*VerifiedBody)(nil)
@@ -0,0 +1,123 @@
+package hmac
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golden-vcr/server-common/entry"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Stream(t *testing.T) {
+	var received []byte
+	var principal *Principal
+	h := StreamingMiddleware(NewVerifier("my-secret"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, principal = nil, nil
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			entry.WriteError(w, r, err)
+			return
+		}
+		received = data
+		principal, _ = r.Body.(*VerifiedBody).Principal()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	send := func(t *testing.T, s Signer, body io.Reader) *http.Response {
+		req, err := http.NewRequest(http.MethodPut, srv.URL+"/scans/123", body)
+		assert.NoError(t, err)
+		req, err = s.(StreamSigner).SignStream(req)
+		assert.NoError(t, err)
+		res, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		res.Body.Close()
+		return res
+	}
+
+	t.Run("streamed body is verified via trailer", func(t *testing.T) {
+		// Stream the body through a pipe so its length isn't known in advance
+		payload := strings.Repeat("scanline ", 100000)
+		pr, pw := io.Pipe()
+		go func() {
+			for i := 0; i < len(payload); i += 4096 {
+				pw.Write([]byte(payload[i:min(i+4096, len(payload))]))
+			}
+			pw.Close()
+		}()
+
+		res := send(t, NewSigner("my-secret", WithSignatureV2("content-type")), pr)
+		assert.Equal(t, http.StatusNoContent, res.StatusCode)
+		assert.Equal(t, payload, string(received))
+		assert.Equal(t, &Principal{Algorithm: AlgorithmHMACSHA256}, principal)
+	})
+	t.Run("request without a body is verified", func(t *testing.T) {
+		res := send(t, NewSigner("my-secret"), nil)
+		assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	})
+	t.Run("verification error is reported at EOF", func(t *testing.T) {
+		res := send(t, NewSigner("wrong-secret"), bytes.NewReader([]byte("hello world")))
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+		assert.Nil(t, received)
+	})
+	t.Run("unsigned request is rejected up-front", func(t *testing.T) {
+		res, err := http.Post(srv.URL, "text/plain", bytes.NewReader([]byte("hello world")))
+		assert.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	})
+}
+
+func Test_VerifiedBody(t *testing.T) {
+	v := NewVerifier("my-secret")
+	body := []byte("hello world")
+
+	t.Run("buffered v2 request can be verified as a stream", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/somewhere", bytes.NewReader(body))
+		assert.NoError(t, err)
+		req, err = NewSigner("my-secret", WithSignatureV2()).Sign(req, body)
+		assert.NoError(t, err)
+
+		vb, err := v.(StreamVerifier).VerifyStream(req)
+		assert.NoError(t, err)
+		_, err = vb.Principal()
+		assert.ErrorIs(t, err, ErrBodyNotConsumed)
+
+		data, err := io.ReadAll(vb)
+		assert.NoError(t, err)
+		assert.Equal(t, body, data)
+		_, err = vb.Principal()
+		assert.NoError(t, err)
+	})
+	t.Run("v1 request can't be verified as a stream", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/somewhere", bytes.NewReader(body))
+		assert.NoError(t, err)
+		req, err = NewSigner("my-secret").Sign(req, body)
+		assert.NoError(t, err)
+
+		_, err = v.(StreamVerifier).VerifyStream(req)
+		assert.ErrorIs(t, err, ErrVerificationFailed)
+	})
+	t.Run("tampered body fails at EOF", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/somewhere", bytes.NewReader(body))
+		assert.NoError(t, err)
+		req, err = NewSigner("my-secret", WithSignatureV2()).Sign(req, body)
+		assert.NoError(t, err)
+		req.Body = io.NopCloser(bytes.NewReader([]byte("hello w0rld")))
+
+		vb, err := v.(StreamVerifier).VerifyStream(req)
+		assert.NoError(t, err)
+		_, err = io.ReadAll(vb)
+		assert.ErrorIs(t, err, ErrVerificationFailed)
+		_, err = vb.Read(make([]byte, 1))
+		assert.True(t, errors.Is(err, ErrVerificationFailed))
+		_, err = vb.Principal()
+		assert.ErrorIs(t, err, ErrVerificationFailed)
+	})
+}
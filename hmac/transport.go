@@ -0,0 +1,52 @@
+package hmac
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// NewTransport returns an http.RoundTripper that signs every outgoing request with the
+// given Signer before passing it to base (or http.DefaultTransport, if base is nil).
+// The request body is buffered in memory so that it can be signed, and GetBody is set
+// so that the request can be safely retried or redirected.
+func NewTransport(s Signer, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{
+		signer: s,
+		base:   base,
+	}
+}
+
+type transport struct {
+	signer Signer
+	base   http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Read the body into memory so that we can sign it: Sign gives the signed copy of
+	// the request a fresh body that can be rewound as needed
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body for signing: %w", err)
+		}
+	}
+
+	// RoundTrippers must not modify the caller's request, so sign a copy of it even if
+	// the signer is configured to sign in place
+	signed := req.Clone(req.Context())
+	signed, err := t.signer.Sign(signed, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign request: %w", err)
+	}
+	setBufferedBody(signed, body)
+	return t.base.RoundTrip(signed)
+}
+
+var _ http.RoundTripper = (*transport)(nil)
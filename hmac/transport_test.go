@@ -0,0 +1,82 @@
+package hmac
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Transport(t *testing.T) {
+	var received [][]byte
+	verified := Middleware(NewVerifier("my-secret"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = append(received, body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	srv := httptest.NewServer(verified)
+	defer srv.Close()
+
+	client := &http.Client{Transport: NewTransport(NewSigner("my-secret"), nil)}
+
+	t.Run("outgoing requests are signed", func(t *testing.T) {
+		received = nil
+		req, err := http.NewRequest(http.MethodPost, srv.URL, bytes.NewReader([]byte("hello world")))
+		assert.NoError(t, err)
+		res, err := client.Do(req)
+		assert.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, http.StatusNoContent, res.StatusCode)
+		assert.Equal(t, [][]byte{[]byte("hello world")}, received)
+		assert.Empty(t, req.Header.Get(HeaderSignature))
+	})
+	t.Run("requests without a body are signed", func(t *testing.T) {
+		received = nil
+		res, err := client.Get(srv.URL)
+		assert.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	})
+	t.Run("unsigned requests are rejected", func(t *testing.T) {
+		res, err := http.Post(srv.URL, "text/plain", bytes.NewReader([]byte("hello world")))
+		assert.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	})
+}
+
+func Test_transport_RoundTrip(t *testing.T) {
+	var signed *http.Request
+	base := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		signed = req
+		return &http.Response{StatusCode: http.StatusNoContent, Body: http.NoBody}, nil
+	})
+	tr := NewTransport(NewSigner("my-secret"), base)
+
+	req, err := http.NewRequest(http.MethodPost, "http://auth.internal/somewhere", io.NopCloser(bytes.NewReader([]byte("hello world"))))
+	assert.NoError(t, err)
+	_, err = tr.RoundTrip(req)
+	assert.NoError(t, err)
+
+	// The signed request should be rewindable, so that the underlying transport can
+	// safely retry it
+	assert.NotSame(t, req, signed)
+	assert.Equal(t, int64(11), signed.ContentLength)
+	for i := 0; i < 2; i++ {
+		body, err := signed.GetBody()
+		assert.NoError(t, err)
+		data, err := io.ReadAll(body)
+		assert.NoError(t, err)
+		assert.Equal(t, "hello world", string(data))
+	}
+	assert.NoError(t, NewVerifier("my-secret").Verify(signed, []byte("hello world")))
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
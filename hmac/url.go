@@ -0,0 +1,156 @@
+package hmac
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/golden-vcr/server-common/entry"
+)
+
+const (
+	// QueryParamExpires is the name of the query parameter that carries the time (in
+	// seconds since the Unix epoch) after which a signed URL is no longer valid
+	QueryParamExpires = "x-hmac-expires"
+
+	// QueryParamKeyId is the name of the query parameter that identifies which key in a
+	// Keyring was used to sign a URL
+	QueryParamKeyId = "x-hmac-key-id"
+
+	// QueryParamSignature is the name of the query parameter that carries the signature
+	// computed from a URL's path and all of its other query parameters
+	QueryParamSignature = "x-hmac-signature"
+)
+
+// SignURL returns a copy of the given URL that remains valid for the given duration,
+// for handing to clients (such as browsers) that can't sign their own requests. The
+// signature covers the URL's path and query, but not its scheme or host, so that the
+// same URL can be resolved via any hostname that routes to the verifying service.
+func SignURL(rawURL string, expiry time.Duration, secret string) (string, error) {
+	return signURL(rawURL, time.Now().Add(expiry), staticKey(Key{Secret: secret}))
+}
+
+// SignURLWithKeyring returns a signed copy of the given URL in the same manner as
+// SignURL, signed with the current key in the given keyring
+func SignURLWithKeyring(rawURL string, expiry time.Duration, keyring *Keyring) (string, error) {
+	return signURL(rawURL, time.Now().Add(expiry), keyringSource{keyring})
+}
+
+func signURL(rawURL string, expiresAt time.Time, keys keySource) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse URL: %w", err)
+	}
+
+	// Discard any existing signature, so that a signed URL can be re-signed with a new
+	// expiry
+	key := keys.signingKey()
+	query := u.Query()
+	query.Del(QueryParamSignature)
+	query.Del(QueryParamKeyId)
+	if key.ID != "" {
+		query.Set(QueryParamKeyId, key.ID)
+	}
+	query.Set(QueryParamExpires, strconv.FormatInt(expiresAt.Unix(), 10))
+	u.RawQuery = query.Encode()
+
+	value, err := computeSignature(AlgorithmHMACSHA256, urlKey(key), messageURL(u))
+	if err != nil {
+		return "", err
+	}
+	query.Set(QueryParamSignature, signature{format: formatURL, algorithm: AlgorithmHMACSHA256, value: value}.String())
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// urlKey returns the key with which URLs are signed: its secret is derived from the
+// given key's secret, so that a signed URL, which is handed to clients that may be
+// untrusted, can never yield a signature that's valid for any other kind of message
+func urlKey(key Key) Key {
+	if key.Secret != "" {
+		key.Secret = hex.EncodeToString(computeHMAC(AlgorithmHMACSHA256, key.Secret, []byte("hmac-url")))
+	}
+	return key
+}
+
+// URLVerifier is implemented by Verifiers that can verify signed URLs, including every
+// Verifier created by this package
+type URLVerifier interface {
+	// AuthenticateURL verifies a URL signed with SignURL, returning a Principal
+	// describing the key with which it was signed
+	AuthenticateURL(u *url.URL) (*Principal, error)
+}
+
+// AuthenticateURL verifies a URL signed with SignURL or SignURLWithKeyring, returning
+// a Principal describing the key with which it was signed. Signed URLs are meant to be
+// reused until they expire, so they're exempt from replay protection.
+func (v *verifier) AuthenticateURL(u *url.URL) (*Principal, error) {
+	query := u.Query()
+	for _, name := range []string{QueryParamExpires, QueryParamSignature} {
+		if query.Get(name) == "" {
+			return nil, fmt.Errorf("%w: query parameter %s", ErrMissingHeader, name)
+		}
+	}
+
+	expires, err := strconv.ParseInt(query.Get(QueryParamExpires), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: '%s' is not a Unix timestamp", ErrTimestampOutOfRange, query.Get(QueryParamExpires))
+	}
+	if expiresAt := time.Unix(expires, 0); !v.now().Before(expiresAt) {
+		return nil, fmt.Errorf("%w: URL expired at %s", ErrTimestampOutOfRange, expiresAt.UTC().Format(time.RFC3339))
+	}
+
+	signatures := parseSignatures(query.Get(QueryParamSignature))
+	key, principal, err := v.resolveKey(credentials{keyId: query.Get(QueryParamKeyId)})
+	if err != nil {
+		return nil, err
+	}
+
+	message := messageURL(u)
+	numCandidates := 0
+	for _, sig := range signatures {
+		if sig.format != formatURL || !v.acceptsAlgorithm(sig.algorithm) {
+			continue
+		}
+		numCandidates++
+		if checkSignatureValue(sig.algorithm, urlKey(key), message, sig.value) {
+			principal.Algorithm = sig.algorithm
+			return principal, nil
+		}
+	}
+	if numCandidates == 0 {
+		return nil, fmt.Errorf("%w: no signature uses an accepted version and algorithm (got %s)", ErrMalformedSignature, formatSignatureLabels(signatures))
+	}
+	return nil, fmt.Errorf("%w: checked %d signature(s) (%s)", ErrSignatureMismatch, numCandidates, formatSignatureLabels(signatures))
+}
+
+// URLMiddleware returns a middleware function that rejects any request whose URL was
+// not signed via SignURL (or SignURLWithKeyring), or whose signed URL has expired. The
+// Principal for each accepted request is available via PrincipalFromContext. Requests
+// fail with a 500 error if v does not implement URLVerifier.
+func URLMiddleware(v Verifier) func(http.Handler) http.Handler {
+	urlVerifier, ok := v.(URLVerifier)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !ok {
+				entry.WriteError(w, r, fmt.Errorf("verifier does not support verifying signed URLs"))
+				return
+			}
+			principal, err := urlVerifier.AuthenticateURL(r.URL)
+			if err != nil {
+				entry.Log(r).Warn("Rejecting request with invalid signed URL", "error", err)
+				entry.WriteError(w, r, err)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), "hmac-principal", principal)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+var _ URLVerifier = (*verifier)(nil)
@@ -0,0 +1,162 @@
+package hmac
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SignURL(t *testing.T) {
+	v := NewVerifier("my-secret").(URLVerifier)
+
+	t.Run("signed URL is verified", func(t *testing.T) {
+		signed, err := SignURL("https://tapes.example.com/images/42.jpg?size=large", time.Minute, "my-secret")
+		assert.NoError(t, err)
+		u, err := url.Parse(signed)
+		assert.NoError(t, err)
+		assert.Equal(t, "large", u.Query().Get("size"))
+		assert.True(t, strings.HasPrefix(u.Query().Get(QueryParamSignature), "url-sha256="))
+
+		principal, err := v.AuthenticateURL(u)
+		assert.NoError(t, err)
+		assert.Equal(t, &Principal{Algorithm: AlgorithmHMACSHA256}, principal)
+	})
+	t.Run("URLs are signed with a key derived from the secret", func(t *testing.T) {
+		signed, err := SignURL("/images/42.jpg", time.Minute, "my-secret")
+		assert.NoError(t, err)
+		u, err := url.Parse(signed)
+		assert.NoError(t, err)
+		signatures := parseSignatures(u.Query().Get(QueryParamSignature))
+		assert.Len(t, signatures, 1)
+
+		plain, err := computeSignature(AlgorithmHMACSHA256, Key{Secret: "my-secret"}, messageURL(u))
+		assert.NoError(t, err)
+		assert.NotEqual(t, plain, signatures[0].value)
+	})
+	t.Run("signature does not cover the host", func(t *testing.T) {
+		signed, err := SignURL("https://tapes.example.com/images/42.jpg", time.Minute, "my-secret")
+		assert.NoError(t, err)
+		u, err := url.Parse(signed)
+		assert.NoError(t, err)
+		u.Host = "tapes.internal"
+		_, err = v.AuthenticateURL(u)
+		assert.NoError(t, err)
+	})
+	t.Run("re-signing a signed URL replaces its signature", func(t *testing.T) {
+		signed, err := SignURL("/images/42.jpg", time.Minute, "other-secret")
+		assert.NoError(t, err)
+		signed, err = SignURL(signed, time.Minute, "my-secret")
+		assert.NoError(t, err)
+		u, err := url.Parse(signed)
+		assert.NoError(t, err)
+		assert.Len(t, u.Query()[QueryParamSignature], 1)
+		_, err = v.AuthenticateURL(u)
+		assert.NoError(t, err)
+	})
+
+	tamperings := []struct {
+		name   string
+		tamper func(u *url.URL)
+		want   error
+	}{
+		{
+			"changing the path",
+			func(u *url.URL) { u.Path = "/images/43.jpg" },
+			ErrSignatureMismatch,
+		},
+		{
+			"adding a query param",
+			func(u *url.URL) { u.RawQuery += "&size=small" },
+			ErrSignatureMismatch,
+		},
+		{
+			"extending the expiry",
+			func(u *url.URL) {
+				query := u.Query()
+				query.Set(QueryParamExpires, "9999999999")
+				u.RawQuery = query.Encode()
+			},
+			ErrSignatureMismatch,
+		},
+		{
+			"removing the signature",
+			func(u *url.URL) {
+				query := u.Query()
+				query.Del(QueryParamSignature)
+				u.RawQuery = query.Encode()
+			},
+			ErrMissingHeader,
+		},
+	}
+	for _, tt := range tamperings {
+		t.Run(tt.name+" invalidates signature", func(t *testing.T) {
+			signed, err := SignURL("/images/42.jpg", time.Minute, "my-secret")
+			assert.NoError(t, err)
+			u, err := url.Parse(signed)
+			assert.NoError(t, err)
+			tt.tamper(u)
+			_, err = v.AuthenticateURL(u)
+			assert.ErrorIs(t, err, tt.want)
+			assert.ErrorIs(t, err, ErrVerificationFailed)
+		})
+	}
+
+	t.Run("expired URL is rejected", func(t *testing.T) {
+		signed, err := SignURL("/images/42.jpg", time.Minute, "my-secret")
+		assert.NoError(t, err)
+		u, err := url.Parse(signed)
+		assert.NoError(t, err)
+
+		v := NewVerifier("my-secret").(*verifier)
+		v.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+		_, err = v.AuthenticateURL(u)
+		assert.ErrorIs(t, err, ErrTimestampOutOfRange)
+	})
+	t.Run("URL signed with keyring is verified after rotation", func(t *testing.T) {
+		keyring, err := NewKeyring("k1", Key{ID: "k1", Secret: "secret-1"})
+		assert.NoError(t, err)
+		signed, err := SignURLWithKeyring("/images/42.jpg", time.Minute, keyring)
+		assert.NoError(t, err)
+		u, err := url.Parse(signed)
+		assert.NoError(t, err)
+		assert.Equal(t, "k1", u.Query().Get(QueryParamKeyId))
+
+		err = keyring.Replace("k2", Key{ID: "k1", Secret: "secret-1"}, Key{ID: "k2", Secret: "secret-2"})
+		assert.NoError(t, err)
+		principal, err := NewKeyringVerifier(keyring).(URLVerifier).AuthenticateURL(u)
+		assert.NoError(t, err)
+		assert.Equal(t, "k1", principal.KeyId)
+
+		err = keyring.Replace("k2", Key{ID: "k2", Secret: "secret-2"})
+		assert.NoError(t, err)
+		_, err = NewKeyringVerifier(keyring).(URLVerifier).AuthenticateURL(u)
+		assert.ErrorIs(t, err, ErrUnknownKey)
+	})
+}
+
+func Test_URLMiddleware(t *testing.T) {
+	h := URLMiddleware(NewVerifier("my-secret"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, ok := PrincipalFromContext(r.Context())
+		assert.True(t, ok)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	t.Run("request for signed URL is passed downstream", func(t *testing.T) {
+		signed, err := SignURL("/clips/abc.mp4", time.Minute, "my-secret")
+		assert.NoError(t, err)
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, signed, nil))
+		assert.Equal(t, http.StatusNoContent, res.Code)
+	})
+	t.Run("request for unsigned URL is rejected with 401", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/clips/abc.mp4", nil))
+		assert.Equal(t, http.StatusUnauthorized, res.Code)
+		assert.Contains(t, res.Body.String(), `"code":"verification_failed"`)
+	})
+}
@@ -1,64 +1,336 @@
 package hmac
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
+	"context"
+	"crypto/ed25519"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
-	"strings"
+	"slices"
+	"time"
+
+	"github.com/golden-vcr/server-common/entry"
 )
 
+// ErrVerificationFailed is returned when a request can't be verified. Every error
+// returned by a Verifier wraps ErrVerificationFailed, and most wrap one of the more
+// specific errors below, along with details that should be logged but never reported
+// to clients.
 var ErrVerificationFailed = errors.New("verification failed")
 
+// ErrMissingHeader is returned when a request lacks one of the headers (or metadata
+// keys, or signed URL query parameters) that's required to verify it
+var ErrMissingHeader = fmt.Errorf("%w: required header is missing", ErrVerificationFailed)
+
+// ErrMalformedSignature is returned when a request's signature is not in a recognized
+// format, or when it carries no signature with a version and algorithm that the
+// verifier accepts
+var ErrMalformedSignature = fmt.Errorf("%w: signature is malformed or unacceptable", ErrVerificationFailed)
+
+// ErrTimestampOutOfRange is returned when a request's timestamp is missing, malformed,
+// or too far from the current time to fall within the verifier's clock-skew window
+var ErrTimestampOutOfRange = fmt.Errorf("%w: request timestamp is outside the allowed window", ErrVerificationFailed)
+
+// ErrUnknownKey is returned when a request identifies a key (or caller) that the
+// verifier doesn't recognize, or a key that has expired
+var ErrUnknownKey = fmt.Errorf("%w: signing key is unknown or expired", ErrVerificationFailed)
+
+// ErrSignatureMismatch is returned when a request's signature does not match the
+// signature computed by the verifier: i.e. the request was modified in transit, or it
+// was signed with a different secret
+var ErrSignatureMismatch = fmt.Errorf("%w: signature does not match", ErrVerificationFailed)
+
+// ErrReplayedRequest is returned when a request carries a request ID that has already
+// been used by a previously-verified request
+var ErrReplayedRequest = fmt.Errorf("%w: request ID has already been used", ErrVerificationFailed)
+
+func init() {
+	entry.RegisterError(ErrVerificationFailed, entry.Error{
+		Status:  http.StatusUnauthorized,
+		Code:    "verification_failed",
+		Message: "request signature could not be verified",
+	})
+}
+
 type Verifier interface {
 	Verify(req *http.Request, body []byte) error
 }
 
-func NewVerifier(secret string) Verifier {
-	return &verifier{
-		secret: secret,
+// PrincipalVerifier is implemented by Verifiers that can describe the credentials with
+// which a verified request was signed, including every Verifier created by this package
+type PrincipalVerifier interface {
+	// Authenticate verifies the request in the same manner as Verify, and if successful,
+	// returns a Principal describing the credentials with which it was signed
+	Authenticate(req *http.Request, body []byte) (*Principal, error)
+}
+
+// authenticate verifies req using v, returning the resulting Principal if v implements
+// PrincipalVerifier, or an empty Principal otherwise
+func authenticate(v Verifier, req *http.Request, body []byte) (*Principal, error) {
+	if pv, ok := v.(PrincipalVerifier); ok {
+		return pv.Authenticate(req, body)
+	}
+	if err := v.Verify(req, body); err != nil {
+		return nil, err
+	}
+	return &Principal{}, nil
+}
+
+// VerifierOption customizes the behavior of a Verifier
+type VerifierOption func(*verifier)
+
+// WithMaxClockSkew causes the verifier to reject any request whose timestamp differs
+// from the current time by more than d, with ErrTimestampOutOfRange
+func WithMaxClockSkew(d time.Duration) VerifierOption {
+	return func(v *verifier) {
+		v.maxClockSkew = d
+	}
+}
+
+// WithNonceStore causes the verifier to record the request ID of every verified
+// request in the given store, and to reject any request whose ID has already been used
+// with ErrReplayedRequest. If no clock-skew window is configured via WithMaxClockSkew,
+// DefaultMaxClockSkew is used.
+func WithNonceStore(store NonceStore) VerifierOption {
+	return func(v *verifier) {
+		v.nonces = store
+	}
+}
+
+// WithMinimumSignatureVersion causes the verifier to reject signatures older than the
+// given version: by default, both SignatureV1 and SignatureV2 signatures are accepted,
+// so that signers can be migrated to SignatureV2 independently
+func WithMinimumSignatureVersion(version SignatureVersion) VerifierOption {
+	return func(v *verifier) {
+		v.minVersion = version
+	}
+}
+
+// WithAcceptedAlgorithms restricts the verifier to accepting only signatures computed
+// with the given algorithms: by default, a signature made with any supported algorithm
+// is accepted, provided that the verifier holds the key material required to check it.
+// If a request carries several signatures, it's accepted if any acceptable signature
+// is valid.
+func WithAcceptedAlgorithms(algorithms ...Algorithm) VerifierOption {
+	return func(v *verifier) {
+		v.algorithms = algorithms
+	}
+}
+
+func NewVerifier(secret string, opts ...VerifierOption) Verifier {
+	return newVerifier(staticKey(Key{Secret: secret}), opts)
+}
+
+// NewEd25519Verifier initializes a Verifier that accepts AlgorithmEd25519 signatures
+// made with the private key corresponding to the given public key
+func NewEd25519Verifier(publicKey ed25519.PublicKey, opts ...VerifierOption) Verifier {
+	return newVerifier(staticKey(Key{PublicKey: publicKey}), opts)
+}
+
+// NewKeyringVerifier initializes a Verifier that accepts signatures made with any
+// unexpired key in the given keyring, as identified by HeaderKeyId. Requests that don't
+// carry a key ID are verified against the keyring's current key.
+func NewKeyringVerifier(keyring *Keyring, opts ...VerifierOption) Verifier {
+	return newVerifier(keyringSource{keyring}, opts)
+}
+
+func newVerifier(keys keySource, opts []VerifierOption) *verifier {
+	v := &verifier{
+		keys:       keys,
+		minVersion: SignatureV1,
+		scheme:     DefaultScheme,
+		now:        time.Now,
 	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	if v.nonces != nil && v.maxClockSkew == 0 {
+		v.maxClockSkew = DefaultMaxClockSkew
+	}
+	return v
 }
 
 type verifier struct {
-	secret string
+	keys         keySource
+	callers      map[string]Caller
+	algorithms   []Algorithm
+	scheme       Scheme
+	minVersion   SignatureVersion
+	maxClockSkew time.Duration
+	nonces       NonceStore
+	now          func() time.Time
 }
 
 func (v *verifier) Verify(req *http.Request, body []byte) error {
-	requestId := req.Header.Get(HeaderRequestId)
+	_, err := v.Authenticate(req, body)
+	return err
+}
+
+func (v *verifier) Authenticate(req *http.Request, body []byte) (*Principal, error) {
+	requestId := req.Header.Get(v.scheme.RequestIdHeader)
 	if requestId == "" {
-		return ErrVerificationFailed
+		return nil, fmt.Errorf("%w: %s", ErrMissingHeader, v.scheme.RequestIdHeader)
 	}
 
-	timestamp := req.Header.Get(HeaderRequestTimestamp)
+	timestamp := req.Header.Get(v.scheme.TimestampHeader)
 	if timestamp == "" {
-		return ErrVerificationFailed
+		return nil, fmt.Errorf("%w: %s", ErrMissingHeader, v.scheme.TimestampHeader)
+	}
+
+	// Reject requests that were made too far in the past (or the future) before doing
+	// any other work
+	requestTime, err := v.checkTimestamp(timestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the signature header to determine which versions of the signing scheme the
+	// request uses, so we can reconstruct the message that was signed
+	signatureValue := req.Header.Get(v.scheme.SignatureHeader)
+	if signatureValue == "" {
+		return nil, fmt.Errorf("%w: %s", ErrMissingHeader, v.scheme.SignatureHeader)
+	}
+	signatures := parseSignatures(signatureValue)
+	messages := make(map[signatureFormat][]byte)
+	for _, sig := range signatures {
+		if _, ok := messages[sig.format]; ok {
+			continue
+		}
+		switch sig.format {
+		case formatV1:
+			if v.minVersion <= SignatureV1 {
+				message := v.scheme.messageV1(requestId, timestamp, body)
+				if isReservedMessage(message) {
+					return nil, fmt.Errorf("%w: SignatureV1 message may not begin with '%s'", ErrMalformedSignature, reservedMessagePrefix)
+				}
+				messages[formatV1] = message
+			}
+		case formatV2:
+			signedHeaders := parseSignedHeaders(req.Header.Get(HeaderSignedHeaders))
+			messages[formatV2] = messageV2(req, requestId, timestamp, signedHeaders, sha256Digest(body))
+		}
+	}
+
+	return v.checkSignature(req.Context(), entry.Log(req), credentials{
+		requestId:   requestId,
+		requestTime: requestTime,
+		keyId:       req.Header.Get(HeaderKeyId),
+		callerId:    req.Header.Get(HeaderCallerId),
+		signatures:  signatures,
+	}, messages)
+}
+
+// checkTimestamp parses the given request timestamp and, if we're configured with a
+// clock-skew window, verifies that it falls within that window
+func (v *verifier) checkTimestamp(timestamp string) (time.Time, error) {
+	if v.maxClockSkew <= 0 {
+		return time.Time{}, nil
+	}
+	requestTime, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: '%s' is not an RFC3339 timestamp", ErrTimestampOutOfRange, timestamp)
+	}
+	if skew := v.now().Sub(requestTime); skew > v.maxClockSkew || skew < -v.maxClockSkew {
+		return time.Time{}, fmt.Errorf("%w: '%s' differs from the current time by %s (max %s)", ErrTimestampOutOfRange, timestamp, skew.Round(time.Second), v.maxClockSkew)
 	}
+	return requestTime, nil
+}
+
+// credentials describes the claims made by a signed request, as read from its headers
+// (or gRPC metadata)
+type credentials struct {
+	requestId   string
+	requestTime time.Time
+	keyId       string
+	callerId    string
+	signatures  []signature
+}
 
-	signatureHeader := req.Header.Get(HeaderSignature)
-	if signatureHeader == "" || !strings.HasPrefix(signatureHeader, "sha256=") {
-		return ErrVerificationFailed
+// checkSignature verifies that at least one of the request's signatures is a valid
+// signature, made with the key identified by its credentials, of the corresponding
+// message for its format; then claims the request ID if we're guarding against replays
+func (v *verifier) checkSignature(ctx context.Context, logger *slog.Logger, c credentials, messages map[signatureFormat][]byte) (*Principal, error) {
+	// Resolve the key identified by the request
+	key, principal, err := v.resolveKey(c)
+	if err != nil {
+		return nil, err
 	}
-	expectedHash := []byte(strings.TrimPrefix(req.Header.Get(HeaderSignature), "sha256="))
 
-	hash := hmac.New(sha256.New, []byte(v.secret))
-	if _, err := hash.Write([]byte(requestId)); err != nil {
-		return fmt.Errorf("failed to write request ID to hash: %w", err)
+	// Check each signature that uses an acceptable format and algorithm until we find
+	// one that's valid
+	numCandidates := 0
+	for _, sig := range c.signatures {
+		message, ok := messages[sig.format]
+		if !ok || !v.acceptsAlgorithm(sig.algorithm) {
+			continue
+		}
+		numCandidates++
+		if checkSignatureValue(sig.algorithm, key, message, sig.value) {
+			principal.Algorithm = sig.algorithm
+			break
+		}
 	}
-	if _, err := hash.Write([]byte(timestamp)); err != nil {
-		return fmt.Errorf("failed to write timestamp string to hash: %w", err)
+	if numCandidates == 0 {
+		return nil, fmt.Errorf("%w: no signature uses an accepted version and algorithm (got %s)", ErrMalformedSignature, formatSignatureLabels(c.signatures))
 	}
-	if _, err := hash.Write(body); err != nil {
-		return fmt.Errorf("failed to write request body to hash: %w", err)
+	if principal.Algorithm == "" {
+		return nil, fmt.Errorf("%w: checked %d signature(s) (%s)", ErrSignatureMismatch, numCandidates, formatSignatureLabels(c.signatures))
 	}
-	computedHash := hex.EncodeToString(hash.Sum(nil))
 
-	if !hmac.Equal(expectedHash, []byte(computedHash)) {
-		return ErrVerificationFailed
+	// The signature is valid: if we're guarding against replays, claim this request ID
+	// so that it can't be reused for as long as its timestamp remains within our window
+	if v.nonces != nil {
+		expiresAt := c.requestTime.Add(v.maxClockSkew)
+		claimed, err := v.nonces.Claim(ctx, c.requestId, expiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check request ID against nonce store: %w", err)
+		}
+		if !claimed {
+			return nil, ErrReplayedRequest
+		}
 	}
-	return nil
+
+	// Note which key was used, calling attention to keys that have been rotated out so
+	// we can tell when it's safe to remove them
+	if principal.Caller != "" {
+		logger.Debug("Verified HMAC signature", "hmacCaller", principal.Caller, "hmacAlgorithm", principal.Algorithm)
+	} else if key.ID != "" {
+		if key.ID != v.keys.signingKey().ID {
+			logger.Info("Verified HMAC signature using non-current key", "hmacKeyId", key.ID, "hmacAlgorithm", principal.Algorithm)
+		} else {
+			logger.Debug("Verified HMAC signature", "hmacKeyId", key.ID, "hmacAlgorithm", principal.Algorithm)
+		}
+	}
+	return principal, nil
+}
+
+// resolveKey returns the key that should be used to verify a request with the given
+// credentials, along with the Principal that the request will be authenticated as if
+// its signature is valid
+func (v *verifier) resolveKey(c credentials) (Key, *Principal, error) {
+	if v.callers != nil {
+		if c.callerId == "" {
+			return Key{}, nil, fmt.Errorf("%w: %s", ErrMissingHeader, HeaderCallerId)
+		}
+		caller, ok := v.callers[c.callerId]
+		if !ok {
+			return Key{}, nil, fmt.Errorf("%w: caller '%s' is not recognized", ErrUnknownKey, c.callerId)
+		}
+		return Key{Secret: caller.Secret, PublicKey: caller.PublicKey}, &Principal{Caller: c.callerId, Scopes: caller.Scopes}, nil
+	}
+	key, ok := v.keys.verificationKey(c.keyId)
+	if !ok {
+		return Key{}, nil, fmt.Errorf("%w: key '%s' is not in the keyring or has expired", ErrUnknownKey, c.keyId)
+	}
+	return key, &Principal{KeyId: key.ID}, nil
+}
+
+// acceptsAlgorithm returns true if the verifier's policy permits signatures computed
+// with the given algorithm
+func (v *verifier) acceptsAlgorithm(alg Algorithm) bool {
+	return len(v.algorithms) == 0 || slices.Contains(v.algorithms, alg)
 }
 
 var _ Verifier = (*verifier)(nil)
+var _ PrincipalVerifier = (*verifier)(nil)
@@ -2,9 +2,14 @@ package hmac
 
 import (
 	"bytes"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/golden-vcr/server-common/entry"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -40,4 +45,234 @@ func Test_Verify(t *testing.T) {
 		err = v.Verify(req, body)
 		assert.NoError(t, err)
 	})
+	t.Run("verification failure is reported to clients as 401", func(t *testing.T) {
+		e := entry.ResolveError(ErrVerificationFailed)
+		assert.Equal(t, http.StatusUnauthorized, e.Status)
+		assert.Equal(t, "verification_failed", e.Code)
+	})
+	t.Run("v2 signature is verified", func(t *testing.T) {
+		body := []byte("hello world")
+		req, err := http.NewRequest(http.MethodPost, "http://auth.internal/somewhere?b=2&a=1", bytes.NewReader(body))
+		assert.NoError(t, err)
+		req.Header.Set(HeaderRequestId, "d6c6a6d0-bb4e-4ff2-8188-4dda238f9223")
+		req.Header.Set(HeaderRequestTimestamp, "2023-12-06T21:06:04+00:00")
+		req.Header.Set(HeaderSignedHeaders, "content-type")
+		req.Header.Set("content-type", "text/plain")
+		req.Header.Set(HeaderSignature, "v2-sha256=013577987cfca5a5a13c0618e9c1eb06e291961b78455033f8f398bb444f361a")
+		err = v.Verify(req, body)
+		assert.NoError(t, err)
+	})
+}
+
+func Test_Verify_v2(t *testing.T) {
+	s := NewSigner("my-secret", WithSignatureV2("content-type"))
+	v := NewVerifier("my-secret")
+	body := []byte(`{"foo":"bar"}`)
+
+	newSignedRequest := func() *http.Request {
+		req, err := http.NewRequest(http.MethodPost, "http://auth.internal/access/grant?x=1&y=2", bytes.NewReader(body))
+		assert.NoError(t, err)
+		req.Header.Set("content-type", "application/json")
+		req, err = s.Sign(req, body)
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(req.Header.Get(HeaderSignature), "v2-sha256="))
+		assert.Equal(t, "content-type", req.Header.Get(HeaderSignedHeaders))
+		return req
+	}
+
+	t.Run("unmodified request is verified", func(t *testing.T) {
+		req := newSignedRequest()
+		assert.NoError(t, v.Verify(req, body))
+	})
+	t.Run("reordering query params does not invalidate signature", func(t *testing.T) {
+		req := newSignedRequest()
+		req.URL.RawQuery = "y=2&x=1"
+		assert.NoError(t, v.Verify(req, body))
+	})
+	tamperings := map[string]func(req *http.Request){
+		"changing the method": func(req *http.Request) {
+			req.Method = http.MethodPut
+		},
+		"changing the path": func(req *http.Request) {
+			req.URL.Path = "/access/revoke"
+		},
+		"changing the query": func(req *http.Request) {
+			req.URL.RawQuery = "x=1&y=3"
+		},
+		"changing a signed header": func(req *http.Request) {
+			req.Header.Set("content-type", "text/plain")
+		},
+		"removing a header from the signed set": func(req *http.Request) {
+			req.Header.Set(HeaderSignedHeaders, "")
+		},
+		"downgrading to a v1 signature": func(req *http.Request) {
+			req.Header.Set(HeaderSignature, strings.Replace(req.Header.Get(HeaderSignature), "v2-", "", 1))
+		},
+	}
+	for name, tamper := range tamperings {
+		t.Run(name+" invalidates signature", func(t *testing.T) {
+			req := newSignedRequest()
+			tamper(req)
+			assert.ErrorIs(t, v.Verify(req, body), ErrVerificationFailed)
+		})
+	}
+	t.Run("v1 signatures are rejected if minimum version is v2", func(t *testing.T) {
+		v := NewVerifier("my-secret", WithMinimumSignatureVersion(SignatureV2))
+		req, err := http.NewRequest(http.MethodPost, "/somewhere", bytes.NewReader(body))
+		assert.NoError(t, err)
+		req, err = NewSigner("my-secret").Sign(req, body)
+		assert.NoError(t, err)
+		assert.ErrorIs(t, v.Verify(req, body), ErrVerificationFailed)
+
+		assert.NoError(t, v.Verify(newSignedRequest(), body))
+	})
+}
+
+func Test_Verify_failureReasons(t *testing.T) {
+	keyring, err := NewKeyring("k1", Key{ID: "k1", Secret: "my-secret"})
+	assert.NoError(t, err)
+	s := NewKeyringSigner(keyring)
+	v := NewKeyringVerifier(keyring, WithMaxClockSkew(5*time.Minute), WithAcceptedAlgorithms(AlgorithmHMACSHA256))
+	body := []byte("hello world")
+
+	newSignedRequest := func() *http.Request {
+		req, err := http.NewRequest(http.MethodPost, "/somewhere", bytes.NewReader(body))
+		assert.NoError(t, err)
+		req, err = s.Sign(req, body)
+		assert.NoError(t, err)
+		return req
+	}
+
+	tests := []struct {
+		name   string
+		modify func(req *http.Request)
+		want   error
+	}{
+		{
+			"missing request ID",
+			func(req *http.Request) { req.Header.Del(HeaderRequestId) },
+			ErrMissingHeader,
+		},
+		{
+			"missing signature",
+			func(req *http.Request) { req.Header.Del(HeaderSignature) },
+			ErrMissingHeader,
+		},
+		{
+			"unrecognized signature format",
+			func(req *http.Request) { req.Header.Set(HeaderSignature, "md5=deadbeef") },
+			ErrMalformedSignature,
+		},
+		{
+			"signature using an unaccepted algorithm",
+			func(req *http.Request) { req.Header.Set(HeaderSignature, "sha512=deadbeef") },
+			ErrMalformedSignature,
+		},
+		{
+			"malformed timestamp",
+			func(req *http.Request) { req.Header.Set(HeaderRequestTimestamp, "yesterday") },
+			ErrTimestampOutOfRange,
+		},
+		{
+			"expired timestamp",
+			func(req *http.Request) {
+				req.Header.Set(HeaderRequestTimestamp, time.Now().Add(-time.Hour).UTC().Format(time.RFC3339))
+			},
+			ErrTimestampOutOfRange,
+		},
+		{
+			"unknown key",
+			func(req *http.Request) { req.Header.Set(HeaderKeyId, "k2") },
+			ErrUnknownKey,
+		},
+		{
+			"incorrect signature",
+			func(req *http.Request) { req.Header.Set(HeaderSignature, "sha256=deadbeef") },
+			ErrSignatureMismatch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newSignedRequest()
+			tt.modify(req)
+			err := v.Verify(req, body)
+			assert.ErrorIs(t, err, tt.want)
+			assert.ErrorIs(t, err, ErrVerificationFailed)
+		})
+	}
+	t.Run("specific reasons are reported to clients only as a generic 401", func(t *testing.T) {
+		err := fmt.Errorf("%w: key 'k2' is not in the keyring or has expired", ErrUnknownKey)
+		e := entry.ResolveError(err)
+		assert.Equal(t, http.StatusUnauthorized, e.Status)
+		assert.Equal(t, "verification_failed", e.Code)
+		assert.NotContains(t, e.Message, "k2")
+		assert.Equal(t, err, e.Err)
+	})
+}
+
+func Test_Verify_otherFormatsAsV1(t *testing.T) {
+	v := NewVerifier("my-secret")
+	key := Key{Secret: "my-secret"}
+
+	// Any message beginning with 'HMAC-<format>\n' can be split into a request ID of 'H',
+	// a timestamp of 'MAC-<format>', and a body holding the rest, so that a signature of
+	// that message would be valid as a V1 signature were it not refused
+	signedURL, err := SignURL("/tapes/42.jpg", time.Minute, "my-secret")
+	assert.NoError(t, err)
+	u, err := url.Parse(signedURL)
+	assert.NoError(t, err)
+	urlSignatures := parseSignatures(u.Query().Get(QueryParamSignature))
+	assert.Len(t, urlSignatures, 1)
+
+	req, err := http.NewRequest(http.MethodPost, "/access/grant", nil)
+	assert.NoError(t, err)
+	tests := []struct {
+		name    string
+		message []byte
+		value   string
+	}{
+		{
+			"v2 signature",
+			messageV2(req, "d6c6a6d0-bb4e-4ff2-8188-4dda238f9223", "2023-12-06T21:06:04Z", nil, sha256Digest([]byte("hello"))),
+			"",
+		},
+		{
+			"grpc signature",
+			messageGRPC("/grpc.health.v1.Health/Check", "d6c6a6d0-bb4e-4ff2-8188-4dda238f9223", "2023-12-06T21:06:04Z", sha256Digest(nil)),
+			"",
+		},
+		{
+			"signed URL",
+			messageURL(u),
+			urlSignatures[0].value,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+" is not accepted as v1", func(t *testing.T) {
+			value := tt.value
+			if value == "" {
+				value, err = computeSignature(AlgorithmHMACSHA256, key, tt.message)
+				assert.NoError(t, err)
+			}
+			prefix, body, ok := bytes.Cut(tt.message, []byte("\n"))
+			assert.True(t, ok)
+
+			forged, err := http.NewRequest(http.MethodPost, "/somewhere", nil)
+			assert.NoError(t, err)
+			forged.Header.Set(HeaderRequestId, string(prefix[:1]))
+			forged.Header.Set(HeaderRequestTimestamp, string(prefix[1:]))
+			forged.Header.Set(HeaderSignature, "sha256="+value)
+			err = v.Verify(forged, append([]byte("\n"), body...))
+			assert.ErrorIs(t, err, ErrMalformedSignature)
+			assert.ErrorIs(t, err, ErrVerificationFailed)
+		})
+	}
+	t.Run("v1 messages that begin with the reserved prefix are not signed", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/somewhere", nil)
+		assert.NoError(t, err)
+		req.Header.Set(HeaderRequestId, "H")
+		req.Header.Set(HeaderRequestTimestamp, "MAC-V2")
+		_, err = NewSigner("my-secret", WithInPlaceSigning()).Sign(req, []byte("\nPOST\n/access/grant"))
+		assert.Error(t, err)
+	})
 }
@@ -0,0 +1,59 @@
+package rmq
+
+import (
+	"context"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Connection is the subset of an *amqp.Connection's functionality that's used by this
+// package, abstracted so that a ManagedConnection can be tested without a RabbitMQ
+// server
+type Connection interface {
+	Channel() (Channel, error)
+	NotifyClose(receiver chan *amqp.Error) chan *amqp.Error
+	IsClosed() bool
+	Close() error
+}
+
+// Channel is the subset of an *amqp.Channel's functionality that's used by this package
+type Channel interface {
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error
+	ConsumeWithContext(ctx context.Context, queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
+	PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+	Close() error
+}
+
+// Dialer is a function that opens a new connection to a RabbitMQ server, which a
+// ManagedConnection calls whenever it needs to (re)connect
+type Dialer func() (Connection, error)
+
+// Dial returns a Dialer that connects to the RabbitMQ server at the given URI, e.g. as
+// built with FormatConnectionString
+func Dial(uri string) Dialer {
+	return func() (Connection, error) {
+		conn, err := amqp.Dial(uri)
+		if err != nil {
+			return nil, err
+		}
+		return &amqpConnection{conn}, nil
+	}
+}
+
+// amqpConnection adapts an *amqp.Connection to the Connection interface
+type amqpConnection struct {
+	*amqp.Connection
+}
+
+func (c *amqpConnection) Channel() (Channel, error) {
+	ch, err := c.Connection.Channel()
+	if err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+var _ Connection = (*amqpConnection)(nil)
+var _ Channel = (*amqp.Channel)(nil)
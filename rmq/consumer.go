@@ -3,6 +3,7 @@ package rmq
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 
@@ -12,7 +13,9 @@ import (
 // HandlerFunc describes a function that your application defines in order to handle
 // events of a specific type consumed from a queue: a nil return value indicates that
 // the message was handled successfully (or ignored) and should be acknowledged; any
-// non-nil error will cause the consumer to halt
+// non-nil error will cause the consumer to halt, unless the queue has a RetryPolicy, in
+// which case the message will be retried (or, if the error is wrapped with Permanent,
+// dead-lettered immediately)
 type HandlerFunc[T any] func(ctx context.Context, logger *slog.Logger, ev *T) error
 
 // Consumer encapsulates the state necessary to run a long-lived consumer process that
@@ -20,6 +23,8 @@ type HandlerFunc[T any] func(ctx context.Context, logger *slog.Logger, ev *T) er
 type Consumer struct {
 	ctx        context.Context
 	logger     *slog.Logger
+	decl       *QueueDeclaration
+	open       channelOpener
 	receiver   Receiver
 	deliveries <-chan amqp.Delivery
 }
@@ -49,6 +54,36 @@ func (d *QueueDeclaration) NewConsumer(ctx context.Context, logger *slog.Logger,
 		return nil, fmt.Errorf("failed to initialize receiver: %w", err)
 	}
 
+	open := func(ctx context.Context) (Channel, error) {
+		ch, err := conn.Channel()
+		if err != nil {
+			return nil, err
+		}
+		return ch, nil
+	}
+	return d.newConsumer(ctx, logger, receiver, open)
+}
+
+// NewManagedConsumer prepares a Consumer that receives messages from this queue via the
+// given ManagedConnection: if the connection is lost, the consumer resubscribes (and
+// redeclares the necessary queues/exchanges/etc.) once it's been reestablished, so that
+// RunConsumer continues to receive messages. You MUST call Close() on the consumer when
+// finished with it.
+func (d *QueueDeclaration) NewManagedConsumer(ctx context.Context, logger *slog.Logger, m *ManagedConnection) (*Consumer, error) {
+	logger = logger.With("queueName", d.Name, "queueType", d.Type)
+	receiver := &managedReceiver{
+		d:      d,
+		m:      m,
+		logger: logger,
+		done:   make(chan struct{}),
+	}
+	return d.newConsumer(ctx, logger, receiver, m.Channel)
+}
+
+// newConsumer begins receiving from the given receiver, returning a Consumer that will
+// process the resulting deliveries when passed to RunConsumer, and which will open
+// channels via open in order to retry or dead-letter failed messages
+func (d *QueueDeclaration) newConsumer(ctx context.Context, logger *slog.Logger, receiver Receiver, open channelOpener) (*Consumer, error) {
 	// Start receiving: this calls Consume on our amqp.Channel, sending an amqp.Delivery
 	// messages to the resulting Go channel each time a message is sent to the queue for
 	// us to receive
@@ -66,6 +101,8 @@ func (d *QueueDeclaration) NewConsumer(ctx context.Context, logger *slog.Logger,
 	return &Consumer{
 		ctx:        ctx,
 		logger:     logger,
+		decl:       d,
+		open:       open,
 		receiver:   receiver,
 		deliveries: deliveries,
 	}, nil
@@ -83,8 +120,11 @@ func (c *Consumer) Close() {
 // processing each delivery by parsing its payload to the appropriate Event type T, then
 // allowing the provided handler function to respond to each message, serially. If any
 // error occurs in message-handling, immediately halts and returns an error, without
-// acknowleding the current message. Returns nil if the deliveries channel closes and no
-// more messages remain.
+// acknowleding the current message, unless the queue has a RetryPolicy: in that case,
+// the message is retried or dead-lettered as configured, and the consumer only halts if
+// it's unable to do so. Returns nil if the deliveries channel closes and no
+// more messages remain: for a Consumer created with NewManagedConsumer, that only
+// happens once its context is done or it's closed.
 func RunConsumer[T any](c *Consumer, f HandlerFunc[T]) error {
 	// Handle deliveries one-at-a-time as long as they're arriving
 	for d := range c.deliveries {
@@ -92,12 +132,27 @@ func RunConsumer[T any](c *Consumer, f HandlerFunc[T]) error {
 		var ev T
 		if err := json.Unmarshal(d.Body, &ev); err != nil {
 			c.logger.Error("Failed to unmarshal message body to event", "messageBody", d.Body, "error", err)
+			if c.decl.Retry != nil {
+				// A message that can't be parsed will never be handled, so there's no point
+				// retrying it
+				if err := c.handleFailure(&d, Permanent(err)); err != nil {
+					return err
+				}
+				continue
+			}
 			return err
 		}
 
 		// Call our user-provided handler function to respond to the event
 		logger := c.logger.With("queueEvent", ev)
 		if err := f(c.ctx, logger, &ev); err != nil {
+			if c.decl.Retry != nil {
+				if err := c.handleFailure(&d, err); err != nil {
+					logger.Error("Failed to retry or dead-letter event", "error", err)
+					return err
+				}
+				continue
+			}
 			logger.Error("Failed to handle event", "error", err)
 			return err
 		}
@@ -105,6 +160,12 @@ func RunConsumer[T any](c *Consumer, f HandlerFunc[T]) error {
 		// Our handler function completed without error, so we can acknowledge the event and
 		// we're done
 		if err := d.Ack(false); err != nil {
+			// If our channel was closed because the connection was lost, the broker will
+			// redeliver the message, so we can carry on with the next delivery
+			if errors.Is(err, amqp.ErrClosed) {
+				logger.Warn("Failed to acknowledge event due to closed channel; it will be redelivered", "error", err)
+				continue
+			}
 			logger.Error("Failed to acknowledge event", "error", err)
 			return err
 		}
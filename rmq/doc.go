@@ -1,4 +1,13 @@
 // Package rmq provides utility code to help backend applications connect to a RabbitMQ
 // server, as well as to produce to and receive from AMQP queues using simplified,
 // higher level semantics
+//
+// Long-lived services should connect via NewManagedConnection, which reconnects if the
+// connection is lost (e.g. when RabbitMQ restarts): consumers and producers created via
+// NewManagedConsumer and NewManagedProducer carry on once the connection is back.
+//
+// By default, a consumer halts as soon as its handler returns an error. Queues that
+// declare a RetryPolicy instead retry failed messages after a delay, then route them to
+// a dead-letter exchange once their retries are exhausted (or immediately, if the
+// handler marks the error as Permanent).
 package rmq
@@ -0,0 +1,369 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// fakeBroker simulates just enough of a RabbitMQ server to exercise this package: it
+// supports work queues (published via the default exchange) and fanout exchanges, and
+// its connections can be dropped at will to simulate a broker restart
+type fakeBroker struct {
+	mu           sync.Mutex
+	dials        int
+	dialErrs     []error
+	conns        []*fakeConnection
+	declarations []string
+	bindings     map[string][]string
+	queueArgs    map[string]amqp.Table
+	pending      map[string][]amqp.Publishing
+	consumers    map[string]*fakeChannel
+	nextQueue    int
+	nextTag      uint64
+	acks         []string
+}
+
+func newFakeBroker() *fakeBroker {
+	return &fakeBroker{
+		bindings:  make(map[string][]string),
+		queueArgs: make(map[string]amqp.Table),
+		pending:   make(map[string][]amqp.Publishing),
+		consumers: make(map[string]*fakeChannel),
+	}
+}
+
+// dial is a Dialer that connects to the broker, failing with the next queued dial
+// error, if any
+func (b *fakeBroker) dial() (Connection, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.dials++
+	if len(b.dialErrs) > 0 {
+		err := b.dialErrs[0]
+		b.dialErrs = b.dialErrs[1:]
+		return nil, err
+	}
+	conn := &fakeConnection{b: b}
+	b.conns = append(b.conns, conn)
+	return conn, nil
+}
+
+// failNextDials causes the next n dial attempts to fail
+func (b *fakeBroker) failNextDials(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i := 0; i < n; i++ {
+		b.dialErrs = append(b.dialErrs, fmt.Errorf("dial %d failed", i))
+	}
+}
+
+// dropConnections simulates a broker restart by abruptly closing every open connection
+func (b *fakeBroker) dropConnections() {
+	b.mu.Lock()
+	conns := b.conns
+	b.conns = nil
+	b.mu.Unlock()
+	for _, conn := range conns {
+		conn.drop(&amqp.Error{Code: amqp.ConnectionForced, Reason: "broker restarting"})
+	}
+}
+
+func (b *fakeBroker) numDials() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.dials
+}
+
+func (b *fakeBroker) numConsumers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.consumers)
+}
+
+func (b *fakeBroker) getDeclarations() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.declarations...)
+}
+
+func (b *fakeBroker) getAcks() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.acks...)
+}
+
+func (b *fakeBroker) getPending(queue string) []amqp.Publishing {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]amqp.Publishing(nil), b.pending[queue]...)
+}
+
+// route delivers a message to the named queue, or enqueues it until a consumer is
+// present; b.mu must be held. Messages with an expiration that are routed to a queue
+// with a dead-letter routing key are dead-lettered once they expire.
+func (b *fakeBroker) route(queue string, msg amqp.Publishing) {
+	if target, ok := b.queueArgs[queue]["x-dead-letter-routing-key"].(string); ok && msg.Expiration != "" {
+		ttl, _ := strconv.Atoi(msg.Expiration)
+		msg.Expiration = ""
+		time.AfterFunc(time.Duration(ttl)*time.Millisecond, func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			b.route(target, msg)
+		})
+		return
+	}
+	if consumer, ok := b.consumers[queue]; ok {
+		b.nextTag++
+		consumer.deliver(b.nextTag, msg)
+		return
+	}
+	b.pending[queue] = append(b.pending[queue], msg)
+}
+
+type fakeConnection struct {
+	b *fakeBroker
+
+	mu       sync.Mutex
+	closed   bool
+	notify   []chan *amqp.Error
+	channels []*fakeChannel
+}
+
+func (c *fakeConnection) Channel() (Channel, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, amqp.ErrClosed
+	}
+	ch := &fakeChannel{conn: c, deliveryBodies: make(map[uint64][]byte)}
+	c.channels = append(c.channels, ch)
+	return ch, nil
+}
+
+func (c *fakeConnection) NotifyClose(receiver chan *amqp.Error) chan *amqp.Error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.notify = append(c.notify, receiver)
+	return receiver
+}
+
+func (c *fakeConnection) IsClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+func (c *fakeConnection) Close() error {
+	c.drop(nil)
+	return nil
+}
+
+func (c *fakeConnection) drop(err *amqp.Error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	channels := c.channels
+	notify := c.notify
+	c.mu.Unlock()
+
+	for _, ch := range channels {
+		ch.Close()
+	}
+	for _, receiver := range notify {
+		if err != nil {
+			receiver <- err
+		}
+		close(receiver)
+	}
+}
+
+type fakeChannel struct {
+	conn *fakeConnection
+
+	mu             sync.Mutex
+	closed         bool
+	queue          string
+	deliveries     chan amqp.Delivery
+	deliveryBodies map[uint64][]byte
+}
+
+func (ch *fakeChannel) isClosed() bool {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	return ch.closed
+}
+
+func (ch *fakeChannel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	if ch.isClosed() {
+		return amqp.ErrClosed
+	}
+	b := ch.conn.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.declarations = append(b.declarations, "exchange:"+name)
+	return nil
+}
+
+func (ch *fakeChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	if ch.isClosed() {
+		return amqp.Queue{}, amqp.ErrClosed
+	}
+	// Like RabbitMQ, we reserve the 'amq.' prefix for server-generated names
+	if strings.HasPrefix(name, "amq.") {
+		return amqp.Queue{}, &amqp.Error{Code: amqp.AccessRefused, Reason: fmt.Sprintf("ACCESS_REFUSED - queue name '%s' contains reserved prefix 'amq.*'", name)}
+	}
+	b := ch.conn.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if name == "" {
+		b.nextQueue++
+		name = fmt.Sprintf("amq.gen-%d", b.nextQueue)
+	}
+	b.declarations = append(b.declarations, "queue:"+name)
+	b.queueArgs[name] = args
+	return amqp.Queue{Name: name}, nil
+}
+
+func (ch *fakeChannel) QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error {
+	if ch.isClosed() {
+		return amqp.ErrClosed
+	}
+	b := ch.conn.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.bindings[exchange] = append(b.bindings[exchange], name)
+	return nil
+}
+
+func (ch *fakeChannel) ConsumeWithContext(ctx context.Context, queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	ch.mu.Lock()
+	if ch.closed {
+		ch.mu.Unlock()
+		return nil, amqp.ErrClosed
+	}
+	ch.queue = queue
+	ch.deliveries = make(chan amqp.Delivery, 16)
+	deliveries := ch.deliveries
+	ch.mu.Unlock()
+
+	b := ch.conn.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.consumers[queue] = ch
+	for _, msg := range b.pending[queue] {
+		b.nextTag++
+		ch.deliver(b.nextTag, msg)
+	}
+	delete(b.pending, queue)
+
+	go func() {
+		<-ctx.Done()
+		ch.Close()
+	}()
+	return deliveries, nil
+}
+
+func (ch *fakeChannel) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	if ch.isClosed() {
+		return amqp.ErrClosed
+	}
+	b := ch.conn.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if exchange == "" {
+		b.route(key, msg)
+		return nil
+	}
+	for _, queue := range b.bindings[exchange] {
+		b.route(queue, msg)
+	}
+	return nil
+}
+
+func (ch *fakeChannel) Close() error {
+	ch.mu.Lock()
+	if ch.closed {
+		ch.mu.Unlock()
+		return nil
+	}
+	ch.closed = true
+	consuming := ch.deliveries != nil
+	if consuming {
+		close(ch.deliveries)
+	}
+	ch.mu.Unlock()
+
+	if consuming {
+		b := ch.conn.b
+		b.mu.Lock()
+		if b.consumers[ch.queue] == ch {
+			delete(b.consumers, ch.queue)
+		}
+		b.mu.Unlock()
+	}
+	return nil
+}
+
+// deliver sends a message to this channel's consumer
+func (ch *fakeChannel) deliver(tag uint64, msg amqp.Publishing) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if ch.closed {
+		return
+	}
+	ch.deliveryBodies[tag] = msg.Body
+	ch.deliveries <- amqp.Delivery{
+		Acknowledger:    ch,
+		DeliveryTag:     tag,
+		Headers:         msg.Headers,
+		ContentType:     msg.ContentType,
+		ContentEncoding: msg.ContentEncoding,
+		DeliveryMode:    msg.DeliveryMode,
+		Priority:        msg.Priority,
+		CorrelationId:   msg.CorrelationId,
+		ReplyTo:         msg.ReplyTo,
+		Expiration:      msg.Expiration,
+		MessageId:       msg.MessageId,
+		Timestamp:       msg.Timestamp,
+		Type:            msg.Type,
+		UserId:          msg.UserId,
+		AppId:           msg.AppId,
+		Body:            msg.Body,
+	}
+}
+
+func (ch *fakeChannel) Ack(tag uint64, multiple bool) error {
+	ch.mu.Lock()
+	closed, body := ch.closed, ch.deliveryBodies[tag]
+	ch.mu.Unlock()
+	if closed {
+		return amqp.ErrClosed
+	}
+	b := ch.conn.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.acks = append(b.acks, string(body))
+	return nil
+}
+
+func (ch *fakeChannel) Nack(tag uint64, multiple, requeue bool) error {
+	return errors.New("not implemented")
+}
+
+func (ch *fakeChannel) Reject(tag uint64, requeue bool) error {
+	return errors.New("not implemented")
+}
+
+var _ Connection = (*fakeConnection)(nil)
+var _ Channel = (*fakeChannel)(nil)
+var _ amqp.Acknowledger = (*fakeChannel)(nil)
@@ -0,0 +1,263 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ErrConnectionClosed is returned when attempting to use a ManagedConnection that has
+// been closed
+var ErrConnectionClosed = errors.New("managed connection is closed")
+
+const (
+	// DefaultMinReconnectDelay is the time a ManagedConnection waits before retrying
+	// after its first failed attempt to reconnect: the first attempt is made as soon as
+	// the connection is lost
+	DefaultMinReconnectDelay = 500 * time.Millisecond
+
+	// DefaultMaxReconnectDelay is the longest time a ManagedConnection will wait
+	// between reconnection attempts, as the delay increases with each failed attempt
+	DefaultMaxReconnectDelay = 30 * time.Second
+)
+
+// ManagedConnectionOption customizes the behavior of a ManagedConnection
+type ManagedConnectionOption func(*ManagedConnection)
+
+// WithReconnectBackoff configures the delay between reconnection attempts, which
+// starts at minDelay and doubles with each failed attempt, up to maxDelay
+func WithReconnectBackoff(minDelay, maxDelay time.Duration) ManagedConnectionOption {
+	return func(m *ManagedConnection) {
+		m.minDelay = minDelay
+		m.maxDelay = maxDelay
+	}
+}
+
+// ManagedConnection maintains a connection to a RabbitMQ server, reconnecting (with
+// backoff) whenever the connection is lost. Consumers and producers created from a
+// ManagedConnection (via NewManagedConsumer and NewManagedProducer) survive broker
+// restarts: consumers resubscribe once the connection is reestablished, and producers
+// block until then. You MUST call Close() on the connection when finished with it.
+type ManagedConnection struct {
+	logger   *slog.Logger
+	dial     Dialer
+	minDelay time.Duration
+	maxDelay time.Duration
+
+	mu           sync.Mutex
+	state        *connectionState
+	declarations []QueueDeclaration
+
+	closeOnce sync.Once
+	done      chan struct{}
+	stopped   chan struct{}
+}
+
+// connectionState tracks a single connection made by a ManagedConnection, from the
+// time we begin trying to connect until that connection is lost
+type connectionState struct {
+	conn    Connection
+	notify  chan *amqp.Error
+	ready   chan struct{}
+	lost    chan struct{}
+	attempt int
+}
+
+func newConnectionState() *connectionState {
+	return &connectionState{
+		ready: make(chan struct{}),
+		lost:  make(chan struct{}),
+	}
+}
+
+// NewManagedConnection connects to a RabbitMQ server using the given Dialer, then
+// begins watching the connection so that it can reconnect if the connection is lost.
+// An error is returned if the initial connection attempt fails.
+func NewManagedConnection(logger *slog.Logger, dial Dialer, opts ...ManagedConnectionOption) (*ManagedConnection, error) {
+	m := &ManagedConnection{
+		logger:   logger,
+		dial:     dial,
+		minDelay: DefaultMinReconnectDelay,
+		maxDelay: DefaultMaxReconnectDelay,
+		state:    newConnectionState(),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if err := m.connect(m.state); err != nil {
+		return nil, fmt.Errorf("failed to connect to AMQP server: %w", err)
+	}
+	go m.run()
+	return m, nil
+}
+
+// Channel opens a new AMQP channel, blocking until the connection is available (or
+// until ctx is done)
+func (m *ManagedConnection) Channel(ctx context.Context) (Channel, error) {
+	for {
+		m.mu.Lock()
+		s := m.state
+		m.mu.Unlock()
+
+		select {
+		case <-s.ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-m.done:
+			return nil, ErrConnectionClosed
+		}
+
+		ch, err := s.conn.Channel()
+		if err == nil {
+			return ch, nil
+		}
+		if !s.conn.IsClosed() {
+			return nil, err
+		}
+
+		// The connection has been lost, but we may not have noticed yet: wait until we
+		// do, then wait for the next connection
+		select {
+		case <-s.lost:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-m.done:
+			return nil, ErrConnectionClosed
+		}
+	}
+}
+
+// Close closes the underlying connection and stops reconnecting. Any consumers or
+// producers that are still using the connection will fail with ErrConnectionClosed.
+func (m *ManagedConnection) Close() {
+	m.closeOnce.Do(func() {
+		close(m.done)
+	})
+	<-m.stopped
+}
+
+// declare registers a queue declaration that must be redeclared whenever we reconnect,
+// and declares it immediately
+func (m *ManagedConnection) declare(ctx context.Context, d QueueDeclaration) error {
+	ch, err := m.Channel(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create channel for %s queue '%s': %w", d.Type, d.Name, err)
+	}
+	defer ch.Close()
+	if err := d.declareForProducer(ch); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, existing := range m.declarations {
+		if existing == d {
+			return nil
+		}
+	}
+	m.declarations = append(m.declarations, d)
+	return nil
+}
+
+// run watches the current connection, reconnecting each time it's lost, until the
+// ManagedConnection is closed
+func (m *ManagedConnection) run() {
+	defer close(m.stopped)
+	for {
+		m.mu.Lock()
+		s := m.state
+		m.mu.Unlock()
+
+		select {
+		case <-m.done:
+			s.conn.Close()
+			return
+		case err := <-s.notify:
+			m.logger.Warn("Lost connection to AMQP server; reconnecting", "error", err)
+		}
+
+		next := newConnectionState()
+		m.mu.Lock()
+		m.state = next
+		m.mu.Unlock()
+		close(s.lost)
+
+		for {
+			err := m.connect(next)
+			if err == nil {
+				m.logger.Info("Reconnected to AMQP server", "attempts", next.attempt)
+				break
+			}
+			delay := m.backoff(next.attempt)
+			m.logger.Error("Failed to reconnect to AMQP server", "error", err, "attempts", next.attempt, "retryDelay", delay)
+			select {
+			case <-m.done:
+				return
+			case <-time.After(delay):
+			}
+		}
+	}
+}
+
+// connect dials a new connection and redeclares all registered queues, marking the
+// given state as ready if successful
+func (m *ManagedConnection) connect(s *connectionState) error {
+	s.attempt++
+	conn, err := m.dial()
+	if err != nil {
+		return err
+	}
+
+	// Register for close notifications before doing anything else, so that we can't
+	// miss a connection that's lost while we're redeclaring
+	notify := conn.NotifyClose(make(chan *amqp.Error, 1))
+	if err := m.redeclare(conn); err != nil {
+		conn.Close()
+		return err
+	}
+
+	s.conn = conn
+	s.notify = notify
+	close(s.ready)
+	return nil
+}
+
+// redeclare declares every queue that's been registered via declare, using the given
+// connection
+func (m *ManagedConnection) redeclare(conn Connection) error {
+	m.mu.Lock()
+	declarations := append([]QueueDeclaration(nil), m.declarations...)
+	m.mu.Unlock()
+	if len(declarations) == 0 {
+		return nil
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("failed to open channel: %w", err)
+	}
+	defer ch.Close()
+	for _, d := range declarations {
+		if err := d.declareForProducer(ch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backoff returns the delay before the next attempt to reconnect, given the number of
+// failed attempts so far
+func (m *ManagedConnection) backoff(attempt int) time.Duration {
+	delay := m.minDelay
+	for i := 1; i < attempt && delay < m.maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, m.maxDelay)
+}
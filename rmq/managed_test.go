@@ -0,0 +1,185 @@
+package rmq
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testEvent struct {
+	N int `json:"n"`
+}
+
+func newTestManagedConnection(t *testing.T, b *fakeBroker) *ManagedConnection {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	m, err := NewManagedConnection(logger, b.dial, WithReconnectBackoff(time.Millisecond, 5*time.Millisecond))
+	assert.NoError(t, err)
+	t.Cleanup(m.Close)
+	return m
+}
+
+func Test_ManagedConnection(t *testing.T) {
+	t.Run("initial connection failure is returned", func(t *testing.T) {
+		b := newFakeBroker()
+		b.failNextDials(1)
+		_, err := NewManagedConnection(slog.Default(), b.dial)
+		assert.ErrorContains(t, err, "dial 0 failed")
+	})
+	t.Run("connection is reestablished after it's lost", func(t *testing.T) {
+		b := newFakeBroker()
+		m := newTestManagedConnection(t, b)
+		assert.Equal(t, 1, b.numDials())
+
+		b.failNextDials(2)
+		b.dropConnections()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		ch, err := m.Channel(ctx)
+		assert.NoError(t, err)
+		assert.NotNil(t, ch)
+		assert.Equal(t, 4, b.numDials())
+	})
+	t.Run("Channel blocks until the connection is reestablished", func(t *testing.T) {
+		b := newFakeBroker()
+		m := newTestManagedConnection(t, b)
+		b.failNextDials(1000)
+		b.dropConnections()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, err := m.Channel(ctx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+	t.Run("Channel fails once the connection is closed", func(t *testing.T) {
+		b := newFakeBroker()
+		m := newTestManagedConnection(t, b)
+		m.Close()
+
+		_, err := m.Channel(context.Background())
+		assert.ErrorIs(t, err, ErrConnectionClosed)
+	})
+	t.Run("producer queues are redeclared after reconnecting", func(t *testing.T) {
+		b := newFakeBroker()
+		m := newTestManagedConnection(t, b)
+		d := &QueueDeclaration{Name: "onscreen-events", Type: QueueTypeFanout}
+		_, err := d.NewManagedProducer(context.Background(), m)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"exchange:onscreen-events"}, b.getDeclarations())
+
+		b.dropConnections()
+		_, err = m.Channel(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"exchange:onscreen-events", "exchange:onscreen-events"}, b.getDeclarations())
+	})
+}
+
+func Test_ManagedConnection_backoff(t *testing.T) {
+	m := &ManagedConnection{minDelay: time.Second, maxDelay: 5 * time.Second}
+	assert.Equal(t, time.Second, m.backoff(1))
+	assert.Equal(t, 2*time.Second, m.backoff(2))
+	assert.Equal(t, 4*time.Second, m.backoff(3))
+	assert.Equal(t, 5*time.Second, m.backoff(4))
+	assert.Equal(t, 5*time.Second, m.backoff(100))
+}
+
+func Test_ManagedConsumer(t *testing.T) {
+	for _, queueType := range []QueueType{QueueTypeWork, QueueTypeFanout} {
+		t.Run(string(queueType)+" consumer resubscribes after connection is lost", func(t *testing.T) {
+			b := newFakeBroker()
+			m := newTestManagedConnection(t, b)
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			d := &QueueDeclaration{Name: "test-queue", Type: queueType}
+			consumer, err := d.NewManagedConsumer(ctx, logger, m)
+			assert.NoError(t, err)
+			defer consumer.Close()
+			producer, err := d.NewManagedProducer(ctx, m)
+			assert.NoError(t, err)
+
+			received := make(chan int, 8)
+			result := make(chan error, 1)
+			go func() {
+				result <- RunConsumer(consumer, func(ctx context.Context, logger *slog.Logger, ev *testEvent) error {
+					received <- ev.N
+					return nil
+				})
+			}()
+
+			// Verify that we can produce and consume a message as normal
+			assert.NoError(t, producer.Send(ctx, testEvent{N: 1}))
+			assert.Equal(t, 1, receive(t, received))
+
+			// Simulate a broker restart: once we're able to reconnect, the producer should
+			// send and the consumer should receive as normal. Fanout consumers receive from
+			// temporary queues, so messages sent before they resubscribe are not received.
+			b.failNextDials(2)
+			b.dropConnections()
+			if queueType == QueueTypeFanout {
+				assert.Eventually(t, func() bool { return b.numConsumers() == 1 }, time.Second, time.Millisecond)
+			}
+			assert.NoError(t, producer.Send(ctx, testEvent{N: 2}))
+			assert.Equal(t, 2, receive(t, received))
+			assert.Equal(t, 4, b.numDials())
+
+			// The consumer should only finish once its context is done
+			cancel()
+			select {
+			case err := <-result:
+				assert.NoError(t, err)
+			case <-time.After(time.Second):
+				t.Fatal("RunConsumer did not return after context was canceled")
+			}
+		})
+	}
+}
+
+func Test_ManagedConsumer_Close(t *testing.T) {
+	t.Run("closing a consumer while disconnected stops RunConsumer", func(t *testing.T) {
+		b := newFakeBroker()
+		m := newTestManagedConnection(t, b)
+		logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+		d := &QueueDeclaration{Name: "test-queue", Type: QueueTypeWork}
+		consumer, err := d.NewManagedConsumer(context.Background(), logger, m)
+		assert.NoError(t, err)
+		result := make(chan error, 1)
+		go func() {
+			result <- RunConsumer(consumer, func(ctx context.Context, logger *slog.Logger, ev *testEvent) error {
+				return nil
+			})
+		}()
+
+		// Take the broker down indefinitely, so that the consumer is left waiting to
+		// resubscribe, then close it
+		b.failNextDials(1000)
+		b.dropConnections()
+		assert.Eventually(t, func() bool { return b.numConsumers() == 0 }, time.Second, time.Millisecond)
+		consumer.Close()
+
+		select {
+		case err := <-result:
+			assert.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("RunConsumer did not return after consumer was closed")
+		}
+	})
+}
+
+// receive waits for a value on the given channel, failing the test if none arrives
+func receive(t *testing.T, ch <-chan int) int {
+	t.Helper()
+	select {
+	case n := <-ch:
+		return n
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting to receive event")
+		return 0
+	}
+}
@@ -2,6 +2,7 @@ package rmq
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	amqp "github.com/rabbitmq/amqp091-go"
@@ -15,6 +16,9 @@ type Producer interface {
 	Send(ctx context.Context, data interface{}) error
 }
 
+// channelOpener is a function that producers call to open a new channel for each send
+type channelOpener func(ctx context.Context) (Channel, error)
+
 // NewProducer ensures that the necessary queues/exchanges/etc. are created and bound
 // for this queue, then prepares a Producer interface that can be used to send messages
 // to the queue
@@ -28,11 +32,78 @@ func (d *QueueDeclaration) NewProducer(conn *amqp.Connection) (Producer, error)
 	}
 	defer ch.Close()
 
+	if err := d.declareForProducer(ch); err != nil {
+		return nil, err
+	}
+	return d.newProducer(func(ctx context.Context) (Channel, error) {
+		ch, err := conn.Channel()
+		if err != nil {
+			return nil, err
+		}
+		return ch, nil
+	}), nil
+}
+
+// NewManagedProducer prepares a Producer that sends messages via the given
+// ManagedConnection, declaring the necessary queues/exchanges/etc. both now and
+// whenever the connection is reestablished. While the connection is down, calls to Send
+// block until it's been reestablished or until their context is done.
+func (d *QueueDeclaration) NewManagedProducer(ctx context.Context, m *ManagedConnection) (Producer, error) {
+	if err := m.declare(ctx, *d); err != nil {
+		return nil, err
+	}
+	return d.newProducer(m.Channel), nil
+}
+
+// declareForProducer ensures that the queues/exchanges/etc. that a producer will send
+// to have been declared
+func (d *QueueDeclaration) declareForProducer(ch Channel) error {
+	switch d.Type {
+	case QueueTypeFanout:
+		if err := declareFanoutExchange(ch, d.Name); err != nil {
+			return fmt.Errorf("failed to declare fanout exchange '%s': %w", d.Name, err)
+		}
+		return nil
+	case QueueTypeWork:
+		if _, err := declareWorkQueue(ch, d.Name); err != nil {
+			return fmt.Errorf("failed to declare work queue '%s': %w", d.Name, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("queue '%s' has unrecognized type %s", d.Name, d.Type)
+}
+
+// newProducer returns a Producer for this queue, which will open channels via the
+// given function; the queue must already have been declared
+func (d *QueueDeclaration) newProducer(open channelOpener) Producer {
 	if d.Type == QueueTypeFanout {
-		return d.newFanoutProducer(conn, ch)
+		return &fanoutProducer{open: open, exchange: d.Name}
 	}
-	if d.Type == QueueTypeWork {
-		return d.newWorkProducer(conn, ch)
+	return &workProducer{open: open, queueName: d.Name}
+}
+
+// maxPublishAttempts is the number of times we'll try to publish a message whose
+// channel is closed out from under us before giving up
+const maxPublishAttempts = 3
+
+// publish opens a channel and publishes a single message on it. If the channel is
+// closed out from under us (i.e. because the connection was lost), we try again with
+// a new channel: this only succeeds if open is able to wait for a new connection.
+func publish(ctx context.Context, open channelOpener, exchange, key string, msg amqp.Publishing) error {
+	var err error
+	for attempt := 0; attempt < maxPublishAttempts; attempt++ {
+		var ch Channel
+		ch, err = open(ctx)
+		if err != nil {
+			return err
+		}
+		mandatory := false
+		immediate := false
+		err = ch.PublishWithContext(ctx, exchange, key, mandatory, immediate, msg)
+		ch.Close()
+		if !errors.Is(err, amqp.ErrClosed) {
+			return err
+		}
 	}
-	return nil, fmt.Errorf("queue '%s' has unrecognized type %s", d.Name, d.Type)
+	return err
 }
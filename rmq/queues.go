@@ -21,4 +21,8 @@ const (
 type QueueDeclaration struct {
 	Name string
 	Type QueueType
+
+	// Retry, if set, causes consumers to retry messages that they fail to handle, then
+	// route them to a dead-letter exchange, rather than halting
+	Retry *RetryPolicy
 }
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 
+	"github.com/google/uuid"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
@@ -12,7 +13,7 @@ import (
 // message queueing scheme in which any number of producers can send messages to a named
 // exchange, and any number of consumers can receive messages by binding their own
 // temporary queue to that exchange
-func declareFanoutExchange(ch *amqp.Channel, exchange string) error {
+func declareFanoutExchange(ch Channel, exchange string) error {
 	durable := true
 	autoDelete := false
 	internal := false
@@ -22,7 +23,7 @@ func declareFanoutExchange(ch *amqp.Channel, exchange string) error {
 
 // declareFanoutConsumerQueue uses an AMQP client to declare a temporary queue for a
 // consumer process, then bind it to the exchange with the given name
-func declareFanoutConsumerQueue(ch *amqp.Channel, exchange string) (*amqp.Queue, error) {
+func declareFanoutConsumerQueue(ch Channel, exchange string) (*amqp.Queue, error) {
 	durable := false
 	autoDelete := false
 	exclusive := true
@@ -42,7 +43,7 @@ func declareFanoutConsumerQueue(ch *amqp.Channel, exchange string) (*amqp.Queue,
 // fanoutProducer is an rmq.Producer implementation that publishes to the configured
 // fanout exchange
 type fanoutProducer struct {
-	conn     *amqp.Connection
+	open     channelOpener
 	exchange string
 }
 
@@ -53,39 +54,29 @@ func (p *fanoutProducer) Send(ctx context.Context, data interface{}) error {
 		return err
 	}
 
-	// Prepare a channel to send our message
-	ch, err := p.conn.Channel()
-	if err != nil {
-		return err
-	}
-	defer ch.Close()
-
 	// Publish to the fanout exchange, which will ensure that a copy of the message is
 	// sent to all consumers which have bound their transient queues to that exchange
-	mandatory := false
-	immediate := false
-	return ch.PublishWithContext(ctx, p.exchange, "", mandatory, immediate, amqp.Publishing{
+	return publish(ctx, p.open, p.exchange, "", amqp.Publishing{
 		ContentType: "application/json",
 		Body:        jsonData,
 	})
 }
 
-func (d *QueueDeclaration) newFanoutProducer(conn *amqp.Connection, ch *amqp.Channel) (Producer, error) {
-	if err := declareFanoutExchange(ch, d.Name); err != nil {
-		return nil, fmt.Errorf("failed to declare fanout exchange '%s': %w", d.Name, err)
-	}
-	return &fanoutProducer{
-		conn:     conn,
-		exchange: d.Name,
-	}, nil
-}
-
 // fanoutReceiver is an rmq.Receiver implementation that receives messages from a
 // temporary queue bound to a fanout exchange
 type fanoutReceiver struct {
-	ch       *amqp.Channel
-	q        *amqp.Queue
-	exchange string
+	ch         Channel
+	q          *amqp.Queue
+	exchange   string
+	retryQueue string
+}
+
+func (c *fanoutReceiver) queueName() string {
+	return c.q.Name
+}
+
+func (c *fanoutReceiver) retryQueueName() string {
+	return c.retryQueue
 }
 
 func (c *fanoutReceiver) Close() {
@@ -100,7 +91,7 @@ func (c *fanoutReceiver) Recv(ctx context.Context) (<-chan amqp.Delivery, error)
 	return c.ch.ConsumeWithContext(ctx, c.q.Name, "", autoAck, exclusive, noLocal, noWait, nil)
 }
 
-func (d *QueueDeclaration) newFanoutReceiver(ch *amqp.Channel) (Receiver, error) {
+func (d *QueueDeclaration) newFanoutReceiver(ch Channel) (Receiver, error) {
 	if err := declareFanoutExchange(ch, d.Name); err != nil {
 		ch.Close()
 		return nil, fmt.Errorf("failed to declare fanout exchange '%s': %w", d.Name, err)
@@ -110,9 +101,12 @@ func (d *QueueDeclaration) newFanoutReceiver(ch *amqp.Channel) (Receiver, error)
 		ch.Close()
 		return nil, fmt.Errorf("failed to declare consumer queue for fanout exchange '%s': %w", d.Name, err)
 	}
+	// Our temporary queue has a server-generated name with the reserved 'amq.' prefix,
+	// so our retry queue (if any) is instead named for the exchange, with a unique suffix
 	return &fanoutReceiver{
-		ch:       ch,
-		q:        q,
-		exchange: d.Name,
+		ch:         ch,
+		q:          q,
+		exchange:   d.Name,
+		retryQueue: d.Name + ".retry." + uuid.NewString(),
 	}, nil
 }
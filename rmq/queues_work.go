@@ -10,7 +10,7 @@ import (
 
 // declareWorkQueue uses an AMQP client to declare a simple persistent queue that can be
 // used to distribute messages to worker processes
-func declareWorkQueue(ch *amqp.Channel, name string) (*amqp.Queue, error) {
+func declareWorkQueue(ch Channel, name string) (*amqp.Queue, error) {
 	durable := false
 	autoDelete := false
 	exclusive := false
@@ -25,8 +25,8 @@ func declareWorkQueue(ch *amqp.Channel, name string) (*amqp.Queue, error) {
 // workProducer is an rmq.Producer implementation that publishes messages to a work
 // queue
 type workProducer struct {
-	conn *amqp.Connection
-	q    *amqp.Queue
+	open      channelOpener
+	queueName string
 }
 
 func (p *workProducer) Send(ctx context.Context, data interface{}) error {
@@ -36,41 +36,29 @@ func (p *workProducer) Send(ctx context.Context, data interface{}) error {
 		return err
 	}
 
-	// Prepare a channel to send our message
-	ch, err := p.conn.Channel()
-	if err != nil {
-		return err
-	}
-	defer ch.Close()
-
 	// Publish directly to the queue, which will choose a single consumer to dispatch the
 	// message to
-	mandatory := false
-	immediate := false
-	return ch.PublishWithContext(ctx, "", p.q.Name, mandatory, immediate, amqp.Publishing{
+	return publish(ctx, p.open, "", p.queueName, amqp.Publishing{
 		ContentType: "application/json",
 		Body:        jsonData,
 	})
 }
 
-func (d *QueueDeclaration) newWorkProducer(conn *amqp.Connection, ch *amqp.Channel) (Producer, error) {
-	q, err := declareWorkQueue(ch, d.Name)
-	if err != nil {
-		return nil, fmt.Errorf("failed to declare work queue '%s': %w", d.Name, err)
-	}
-	return &workProducer{
-		conn: conn,
-		q:    q,
-	}, nil
-}
-
 // workReceiver is an rmq.Receiver implementation that contends with other consumers to
 // receive messages from a work queue
 type workReceiver struct {
-	ch *amqp.Channel
+	ch Channel
 	q  *amqp.Queue
 }
 
+func (c *workReceiver) queueName() string {
+	return c.q.Name
+}
+
+func (c *workReceiver) retryQueueName() string {
+	return c.q.Name + ".retry"
+}
+
 func (c *workReceiver) Close() {
 	c.ch.Close()
 }
@@ -83,7 +71,7 @@ func (c *workReceiver) Recv(ctx context.Context) (<-chan amqp.Delivery, error) {
 	return c.ch.ConsumeWithContext(ctx, c.q.Name, "", autoAck, exclusive, noLocal, noWait, nil)
 }
 
-func (d *QueueDeclaration) newWorkReceiver(ch *amqp.Channel) (Receiver, error) {
+func (d *QueueDeclaration) newWorkReceiver(ch Channel) (Receiver, error) {
 	q, err := declareWorkQueue(ch, d.Name)
 	if err != nil {
 		ch.Close()
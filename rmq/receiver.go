@@ -3,6 +3,9 @@ package rmq
 import (
 	"context"
 	"fmt"
+	"log/slog"
+	"sync"
+	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
@@ -15,14 +18,211 @@ type Receiver interface {
 	Recv(ctx context.Context) (<-chan amqp.Delivery, error)
 }
 
+// namedReceiver is a Receiver that can report the name of the queue it's currently
+// receiving from, along with the name of the TTL retry queue that feeds back into it
+type namedReceiver interface {
+	queueName() string
+	retryQueueName() string
+}
+
 // initReceiver initializes a Receiver on the given channel based on the canonical usage
 // pattern for this queue
-func (d *QueueDeclaration) initReceiver(ch *amqp.Channel) (Receiver, error) {
-	if d.Type == QueueTypeFanout {
-		return d.newFanoutReceiver(ch)
+func (d *QueueDeclaration) initReceiver(ch Channel) (Receiver, error) {
+	var receiver Receiver
+	var err error
+	switch d.Type {
+	case QueueTypeFanout:
+		receiver, err = d.newFanoutReceiver(ch)
+	case QueueTypeWork:
+		receiver, err = d.newWorkReceiver(ch)
+	default:
+		return nil, fmt.Errorf("queue '%s' has unrecognized type %s", d.Name, d.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// If failed messages are to be retried, declare the queues/exchanges they'll be
+	// routed through
+	if d.Retry != nil {
+		named := receiver.(namedReceiver)
+		if err := d.declareRetryQueues(ch, named.queueName(), named.retryQueueName()); err != nil {
+			receiver.Close()
+			return nil, err
+		}
+	}
+	return receiver, nil
+}
+
+// managedReceiver is an rmq.Receiver implementation that receives from a queue via a
+// ManagedConnection, resubscribing whenever its underlying receiver's deliveries stop
+// because the connection was lost
+type managedReceiver struct {
+	d      *QueueDeclaration
+	m      *ManagedConnection
+	logger *slog.Logger
+
+	mu        sync.Mutex
+	current   Receiver
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func (r *managedReceiver) Close() {
+	r.closeOnce.Do(func() {
+		close(r.done)
+	})
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.current != nil {
+		r.current.Close()
+		r.current = nil
+	}
+}
+
+func (r *managedReceiver) queueName() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.current == nil {
+		return ""
+	}
+	return r.current.(namedReceiver).queueName()
+}
+
+func (r *managedReceiver) retryQueueName() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.current == nil {
+		return ""
+	}
+	return r.current.(namedReceiver).retryQueueName()
+}
+
+func (r *managedReceiver) Recv(ctx context.Context) (<-chan amqp.Delivery, error) {
+	// Subscribe once up front so that the caller finds out immediately if the queue
+	// can't be consumed from at all
+	deliveries, err := r.subscribe(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan amqp.Delivery)
+	go r.forward(ctx, deliveries, out)
+	return out, nil
+}
+
+// subscribe opens a new channel, declares our queue on it, and begins consuming
+func (r *managedReceiver) subscribe(ctx context.Context) (<-chan amqp.Delivery, error) {
+	ch, err := r.openChannel(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open channel: %w", err)
+	}
+	receiver, err := r.d.initReceiver(ch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize receiver: %w", err)
 	}
-	if d.Type == QueueTypeWork {
-		return d.newWorkReceiver(ch)
+	deliveries, err := receiver.Recv(ctx)
+	if err != nil {
+		receiver.Close()
+		return nil, fmt.Errorf("failed to initialize recv channel: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	select {
+	case <-r.done:
+		receiver.Close()
+		return nil, ErrConnectionClosed
+	default:
+	}
+	if r.current != nil {
+		r.current.Close()
+	}
+	r.current = receiver
+	return deliveries, nil
+}
+
+// openChannel opens a new channel, blocking until the connection is available, ctx is
+// done, or the receiver is closed
+func (r *managedReceiver) openChannel(ctx context.Context) (Channel, error) {
+	// The resulting context only governs the wait for a channel: once we've subscribed,
+	// our deliveries are tied to the caller's ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-r.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	ch, err := r.m.Channel(ctx)
+	if err != nil {
+		select {
+		case <-r.done:
+			return nil, ErrConnectionClosed
+		default:
+			return nil, err
+		}
+	}
+	return ch, nil
+}
+
+// forward passes deliveries along to out, resubscribing each time the deliveries
+// channel is closed, until ctx is done or the receiver is closed
+func (r *managedReceiver) forward(ctx context.Context, deliveries <-chan amqp.Delivery, out chan<- amqp.Delivery) {
+	defer close(out)
+	for {
+		for d := range deliveries {
+			select {
+			case out <- d:
+			case <-ctx.Done():
+				return
+			case <-r.done:
+				return
+			}
+		}
+		if r.stopped(ctx) {
+			return
+		}
+
+		// Our deliveries channel was closed out from under us, presumably because the
+		// connection was lost: keep trying to resubscribe (which will block until we're
+		// reconnected) until we succeed
+		r.logger.Warn("Consumer lost its subscription; resubscribing")
+		for attempt := 1; ; attempt++ {
+			var err error
+			deliveries, err = r.subscribe(ctx)
+			if err == nil {
+				r.logger.Info("Consumer resubscribed")
+				break
+			}
+			if r.stopped(ctx) {
+				return
+			}
+			delay := r.m.backoff(attempt)
+			r.logger.Error("Failed to resubscribe consumer", "error", err, "retryDelay", delay)
+			select {
+			case <-ctx.Done():
+				return
+			case <-r.done:
+				return
+			case <-time.After(delay):
+			}
+		}
+	}
+}
+
+// stopped returns true if the receiver should stop forwarding deliveries
+func (r *managedReceiver) stopped(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return true
+	case <-r.done:
+		return true
+	case <-r.m.done:
+		return true
+	default:
+		return false
 	}
-	return nil, fmt.Errorf("queue '%s' has unrecognized type %s", d.Name, d.Type)
 }
@@ -0,0 +1,196 @@
+package rmq
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// HeaderAttempt is the name of the AMQP header that records which attempt at
+	// handling a message a delivery represents, starting at 1; it's omitted from a
+	// message's first delivery
+	HeaderAttempt = "x-rmq-attempt"
+
+	// HeaderError is the name of the AMQP header that records the error that caused a
+	// message to be dead-lettered
+	HeaderError = "x-rmq-error"
+)
+
+// RetryPolicy configures how a consumer responds when its handler fails to handle a
+// message: rather than halting, the consumer redelivers the message after a delay, up
+// to MaxRetries times, before giving up and routing it to the queue's dead-letter
+// exchange. Retries are implemented with a TTL retry queue (named '<queue>.retry', or
+// '<name>.retry.<uuid>' for each consumer of a fanout queue) which dead-letters expired
+// messages back to the consumer's queue. The dead-letter exchange is a fanout exchange
+// named '<name>.dlx', bound to a durable queue named '<name>.dead' in which
+// dead-lettered messages are retained for inspection.
+//
+// A fanout consumer's retry queue is as temporary as the queue it feeds back into: if
+// the consumer's connection is lost, any retries that are still pending are discarded
+// along with both queues, just as messages sent while the consumer is disconnected are
+// never received. A consumer created with NewManagedConsumer gets new queues when it
+// resubscribes.
+type RetryPolicy struct {
+	// MaxRetries is the number of times a failed message will be retried before it's
+	// dead-lettered
+	MaxRetries int
+
+	// Delay is the time to wait before each retry
+	Delay time.Duration
+}
+
+// DeadLetterExchange returns the name of the exchange to which this queue's consumers
+// route messages that can't be handled
+func (d *QueueDeclaration) DeadLetterExchange() string {
+	return d.Name + ".dlx"
+}
+
+// DeadLetterQueue returns the name of the durable queue in which this queue's
+// dead-lettered messages are retained
+func (d *QueueDeclaration) DeadLetterQueue() string {
+	return d.Name + ".dead"
+}
+
+// permanentError wraps an error that should not be retried
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent wraps an error returned by a HandlerFunc to indicate that retrying the
+// message would be futile: if the queue has a RetryPolicy, the message is dead-lettered
+// immediately
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err}
+}
+
+// IsPermanent returns true if err was marked as permanent via Permanent
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+// declareRetryQueues declares the named TTL retry queue for the given consumer queue,
+// along with the dead-letter exchange and queue
+func (d *QueueDeclaration) declareRetryQueues(ch Channel, queueName string, retryQueueName string) error {
+	// The retry queue shares the lifetime of the consumer queue that it feeds back into:
+	// a fanout consumer's temporary queue gets an equally temporary retry queue. We
+	// don't set a TTL on the queue itself: each retried message carries its own
+	// expiration.
+	durable := false
+	autoDelete := false
+	exclusive := d.Type == QueueTypeFanout
+	noWait := false
+	_, err := ch.QueueDeclare(retryQueueName, durable, autoDelete, exclusive, noWait, amqp.Table{
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": queueName,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to declare retry queue for '%s': %w", queueName, err)
+	}
+
+	// Declare a durable dead-letter exchange, with a durable queue bound to it so that
+	// dead-lettered messages are retained until someone inspects them
+	if err := declareFanoutExchange(ch, d.DeadLetterExchange()); err != nil {
+		return fmt.Errorf("failed to declare dead-letter exchange '%s': %w", d.DeadLetterExchange(), err)
+	}
+	durable = true
+	exclusive = false
+	q, err := ch.QueueDeclare(d.DeadLetterQueue(), durable, autoDelete, exclusive, noWait, nil)
+	if err != nil {
+		return fmt.Errorf("failed to declare dead-letter queue '%s': %w", d.DeadLetterQueue(), err)
+	}
+	if err := ch.QueueBind(q.Name, "", d.DeadLetterExchange(), noWait, nil); err != nil {
+		return fmt.Errorf("failed to bind dead-letter queue '%s': %w", d.DeadLetterQueue(), err)
+	}
+	return nil
+}
+
+// deliveryAttempt returns which attempt at handling a message the given delivery
+// represents, starting at 1
+func deliveryAttempt(d *amqp.Delivery) int {
+	switch value := d.Headers[HeaderAttempt].(type) {
+	case int32:
+		return int(value)
+	case int64:
+		return int(value)
+	case int:
+		return value
+	case string:
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return 1
+}
+
+// handleFailure responds to a message that could not be handled, per the consumer's
+// RetryPolicy: it republishes a copy of the message to either the retry queue or the
+// dead-letter exchange, then acknowledges the original delivery
+func (c *Consumer) handleFailure(d *amqp.Delivery, handlerErr error) error {
+	attempt := deliveryAttempt(d)
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+
+	// Preserve the original message's properties, except for its expiration (which we
+	// set only for retries) and its user ID (which the broker would reject unless we're
+	// connected as the same user that originally published the message)
+	msg := amqp.Publishing{
+		Headers:         headers,
+		ContentType:     d.ContentType,
+		ContentEncoding: d.ContentEncoding,
+		DeliveryMode:    d.DeliveryMode,
+		Priority:        d.Priority,
+		CorrelationId:   d.CorrelationId,
+		ReplyTo:         d.ReplyTo,
+		MessageId:       d.MessageId,
+		Timestamp:       d.Timestamp,
+		Type:            d.Type,
+		AppId:           d.AppId,
+		Body:            d.Body,
+	}
+
+	ctx := c.ctx
+	logger := c.logger.With("attempt", attempt, "error", handlerErr)
+	if IsPermanent(handlerErr) || attempt > c.decl.Retry.MaxRetries {
+		headers[HeaderError] = handlerErr.Error()
+		if err := publish(ctx, c.open, c.decl.DeadLetterExchange(), "", msg); err != nil {
+			return fmt.Errorf("failed to dead-letter message: %w", err)
+		}
+		logger.Error("Message could not be handled; routed to dead-letter exchange", "deadLetterExchange", c.decl.DeadLetterExchange())
+	} else {
+		named, ok := c.receiver.(namedReceiver)
+		if !ok {
+			return fmt.Errorf("receiver does not support retries")
+		}
+		headers[HeaderAttempt] = int32(attempt + 1)
+		msg.Expiration = strconv.FormatInt(c.decl.Retry.Delay.Milliseconds(), 10)
+		if err := publish(ctx, c.open, "", named.retryQueueName(), msg); err != nil {
+			return fmt.Errorf("failed to schedule retry: %w", err)
+		}
+		logger.Warn("Failed to handle event; scheduled retry", "retryDelay", c.decl.Retry.Delay)
+	}
+
+	// The message has been handed off to the retry queue or dead-letter exchange, so we
+	// can remove it from our queue
+	if err := d.Ack(false); err != nil && !errors.Is(err, amqp.ErrClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_RunConsumer_retries(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// runConsumer sends a single message to a queue of the given type with the given
+	// retry policy, then runs a consumer with the given handler until it has been called
+	// the given number of times
+	runConsumer := func(t *testing.T, b *fakeBroker, queueType QueueType, retry *RetryPolicy, numCalls int, f func(attempt int) error) error {
+		m := newTestManagedConnection(t, b)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		d := &QueueDeclaration{Name: "test-queue", Type: queueType, Retry: retry}
+		consumer, err := d.NewManagedConsumer(ctx, logger, m)
+		assert.NoError(t, err)
+		defer consumer.Close()
+		producer, err := d.NewManagedProducer(ctx, m)
+		assert.NoError(t, err)
+		assert.NoError(t, producer.Send(ctx, testEvent{N: 1}))
+
+		calls := make(chan int, 16)
+		result := make(chan error, 1)
+		attempt := 0
+		go func() {
+			result <- RunConsumer(consumer, func(ctx context.Context, logger *slog.Logger, ev *testEvent) error {
+				attempt++
+				calls <- attempt
+				return f(attempt)
+			})
+		}()
+		for i := 0; i < numCalls; i++ {
+			receive(t, calls)
+		}
+
+		select {
+		case err := <-result:
+			return err
+		case <-time.After(20 * time.Millisecond):
+		}
+		cancel()
+		select {
+		case err := <-result:
+			assert.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("RunConsumer did not return after context was canceled")
+		}
+		select {
+		case n := <-calls:
+			t.Fatalf("handler was called unexpectedly (call %d)", n)
+		default:
+		}
+		return nil
+	}
+
+	t.Run("without a retry policy, consumer halts on first error", func(t *testing.T) {
+		b := newFakeBroker()
+		err := runConsumer(t, b, QueueTypeWork, nil, 1, func(attempt int) error {
+			return fmt.Errorf("failed")
+		})
+		assert.EqualError(t, err, "failed")
+	})
+	t.Run("failed message is retried until it succeeds", func(t *testing.T) {
+		b := newFakeBroker()
+		err := runConsumer(t, b, QueueTypeWork, &RetryPolicy{MaxRetries: 3, Delay: time.Millisecond}, 3, func(attempt int) error {
+			if attempt < 3 {
+				return fmt.Errorf("failed on attempt %d", attempt)
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Contains(t, b.getDeclarations(), "queue:test-queue.retry")
+		assert.Empty(t, b.getPending("test-queue.dead"))
+	})
+	t.Run("fanout consumer retries via its own retry queue", func(t *testing.T) {
+		b := newFakeBroker()
+		err := runConsumer(t, b, QueueTypeFanout, &RetryPolicy{MaxRetries: 3, Delay: time.Millisecond}, 3, func(attempt int) error {
+			if attempt < 3 {
+				return fmt.Errorf("failed on attempt %d", attempt)
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+		var retryQueues []string
+		for _, declaration := range b.getDeclarations() {
+			if strings.HasPrefix(declaration, "queue:test-queue.retry.") {
+				retryQueues = append(retryQueues, declaration)
+			}
+		}
+		assert.Len(t, retryQueues, 1)
+		assert.Empty(t, b.getPending("test-queue.dead"))
+	})
+	t.Run("message is dead-lettered once retries are exhausted", func(t *testing.T) {
+		b := newFakeBroker()
+		err := runConsumer(t, b, QueueTypeWork, &RetryPolicy{MaxRetries: 2, Delay: time.Millisecond}, 3, func(attempt int) error {
+			return fmt.Errorf("failed on attempt %d", attempt)
+		})
+		assert.NoError(t, err)
+
+		dead := b.getPending("test-queue.dead")
+		if assert.Len(t, dead, 1) {
+			assert.JSONEq(t, `{"n":1}`, string(dead[0].Body))
+			assert.Equal(t, int32(3), dead[0].Headers[HeaderAttempt])
+			assert.Equal(t, "failed on attempt 3", dead[0].Headers[HeaderError])
+		}
+	})
+	t.Run("permanent error is dead-lettered without retrying", func(t *testing.T) {
+		b := newFakeBroker()
+		err := runConsumer(t, b, QueueTypeWork, &RetryPolicy{MaxRetries: 2, Delay: time.Millisecond}, 1, func(attempt int) error {
+			return Permanent(errors.New("invalid event"))
+		})
+		assert.NoError(t, err)
+
+		dead := b.getPending("test-queue.dead")
+		if assert.Len(t, dead, 1) {
+			assert.Nil(t, dead[0].Headers[HeaderAttempt])
+			assert.Equal(t, "invalid event", dead[0].Headers[HeaderError])
+		}
+	})
+}
+
+func Test_Consumer_handleFailure(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	b := newFakeBroker()
+	m := newTestManagedConnection(t, b)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d := &QueueDeclaration{Name: "test-queue", Type: QueueTypeWork, Retry: &RetryPolicy{MaxRetries: 0}}
+	consumer, err := d.NewManagedConsumer(ctx, logger, m)
+	assert.NoError(t, err)
+	defer consumer.Close()
+
+	// Publish a message with a full set of properties, which should all be preserved
+	// when the message is dead-lettered
+	ch, err := m.Channel(ctx)
+	assert.NoError(t, err)
+	timestamp := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	assert.NoError(t, ch.PublishWithContext(ctx, "", "test-queue", false, false, amqp.Publishing{
+		Headers:         amqp.Table{"x-custom": "value"},
+		ContentType:     "application/json",
+		ContentEncoding: "identity",
+		DeliveryMode:    amqp.Persistent,
+		Priority:        3,
+		CorrelationId:   "correlation-id",
+		ReplyTo:         "reply-queue",
+		MessageId:       "message-id",
+		Timestamp:       timestamp,
+		Type:            "test-event",
+		AppId:           "test-app",
+		Body:            []byte(`{"n":1}`),
+	}))
+
+	result := make(chan error, 1)
+	go func() {
+		result <- RunConsumer(consumer, func(ctx context.Context, logger *slog.Logger, ev *testEvent) error {
+			return errors.New("failed")
+		})
+	}()
+	assert.Eventually(t, func() bool { return len(b.getPending("test-queue.dead")) == 1 }, time.Second, time.Millisecond)
+	cancel()
+	assert.NoError(t, <-result)
+
+	dead := b.getPending("test-queue.dead")[0]
+	assert.Equal(t, "value", dead.Headers["x-custom"])
+	assert.Equal(t, "failed", dead.Headers[HeaderError])
+	assert.Equal(t, "application/json", dead.ContentType)
+	assert.Equal(t, "identity", dead.ContentEncoding)
+	assert.Equal(t, amqp.Persistent, dead.DeliveryMode)
+	assert.Equal(t, uint8(3), dead.Priority)
+	assert.Equal(t, "correlation-id", dead.CorrelationId)
+	assert.Equal(t, "reply-queue", dead.ReplyTo)
+	assert.Equal(t, "message-id", dead.MessageId)
+	assert.Equal(t, timestamp, dead.Timestamp)
+	assert.Equal(t, "test-event", dead.Type)
+	assert.Equal(t, "test-app", dead.AppId)
+	assert.Empty(t, dead.Expiration)
+}
+
+func Test_Permanent(t *testing.T) {
+	err := errors.New("bad input")
+	assert.True(t, IsPermanent(Permanent(err)))
+	assert.True(t, IsPermanent(fmt.Errorf("wrapped: %w", Permanent(err))))
+	assert.ErrorIs(t, Permanent(err), err)
+	assert.False(t, IsPermanent(err))
+	assert.Nil(t, Permanent(nil))
+}
@@ -54,11 +54,20 @@ func (h *Handler[T]) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 	// If a content-type is explicitly requested, require that it's text/event-stream
 	accept := req.Header.Get("accept")
 	if accept != "" && accept != "*/*" && !strings.HasPrefix(accept, "text/event-stream") {
-		message := fmt.Sprintf("content-type %s is not supported", accept)
-		http.Error(res, message, http.StatusBadRequest)
+		entry.WriteError(res, req, &entry.Error{
+			Status:  http.StatusBadRequest,
+			Code:    "unsupported_content_type",
+			Message: fmt.Sprintf("content-type %s is not supported", accept),
+		})
 		return
 	}
 
+	// This connection is expected to stay open indefinitely, so exempt it from the
+	// server's read/write timeouts
+	if err := entry.DisableTimeouts(res); err != nil {
+		logger.Debug("Unable to disable timeouts for SSE connection", "error", err)
+	}
+
 	// Keep the connection alive and open a text/event-stream response body
 	res.Header().Set("content-type", "text/event-stream")
 	res.Header().Set("cache-control", "no-cache")